@@ -0,0 +1,305 @@
+// ack
+package monitor
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+//默认确认链接有效期
+const DefaultAckLinkTTL = 24 * time.Hour
+
+//故障确认
+type Ack struct {
+	Time    time.Time `json:"time"`
+	By      string    `json:"by,omitempty"`
+	Comment string    `json:"comment,omitempty"`
+}
+
+//故障确认配置
+type AckConf struct {
+	//守护进程模式下确认及静默接口的监听地址，如:8080，配置后ack、silence命令通过该接口操作
+	Listen string `yaml:"listen"`
+	//告警消息中确认链接的地址前缀，如https://monitor.example.com，为空时不生成链接
+	URL string `yaml:"url"`
+	//确认链接的签名密钥，及ack、silence命令请求的认证密钥
+	Secret string `yaml:"secret"`
+	//确认链接有效期，默认24h
+	LinkTTL time.Duration `yaml:"link_ttl"`
+}
+
+//补全默认值
+func (c AckConf) withDefaults() AckConf {
+	if c.LinkTTL <= 0 {
+		c.LinkTTL = DefaultAckLinkTTL
+	}
+	return c
+}
+
+//确认请求签名：hex(HmacSHA256(secret, instance+"\n"+incident+"\n"+expires))
+func ackSign(secret string, instance string, incident int64, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%d\n%d", instance, incident, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+//带签名的确认请求参数，incident为故障开始时间（Unix纳秒），0表示实例当前的故障
+func (c AckConf) query(instance string, incident int64, expires time.Time) url.Values {
+	query := url.Values{}
+	query.Set("i", instance)
+	query.Set("incident", strconv.FormatInt(incident, 10))
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("sig", ackSign(c.Secret, instance, incident, expires.Unix()))
+	return query
+}
+
+//告警消息中的确认链接，只能确认该次故障；未配置url或secret时返回空
+func (c AckConf) Link(instance string, incident time.Time, now time.Time) string {
+	if c.URL == "" || c.Secret == "" {
+		return ""
+	}
+	c = c.withDefaults()
+	return strings.TrimRight(c.URL, "/") + "/ack?" + c.query(instance, incident.UnixNano(), now.Add(c.LinkTTL)).Encode()
+}
+
+//校验确认请求的签名及有效期，返回实例及故障开始时间
+func (c AckConf) verify(query url.Values, now time.Time) (string, int64, error) {
+	if c.Secret == "" {
+		return "", 0, errors.New("ack secret not configured")
+	}
+	instance := query.Get("i")
+	incident, err1 := strconv.ParseInt(query.Get("incident"), 10, 64)
+	expires, err2 := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if instance == "" || err1 != nil || err2 != nil {
+		return "", 0, errors.New("invalid ack link")
+	}
+	if !hmac.Equal([]byte(query.Get("sig")), []byte(ackSign(c.Secret, instance, incident, expires))) {
+		return "", 0, errors.New("invalid signature")
+	}
+	if now.Unix() > expires {
+		return "", 0, errors.New("ack link expired")
+	}
+	return instance, incident, nil
+}
+
+//本机访问守护进程接口的地址
+func (c AckConf) localURL() (string, error) {
+	host, port, err := net.SplitHostPort(c.Listen)
+	if err != nil {
+		return "", fmt.Errorf("invalid ack listen address %q: %v", c.Listen, err)
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port), nil
+}
+
+//ack命令通过守护进程的确认接口确认故障
+func RemoteAck(c AckConf, instance string, ack Ack) error {
+	base, err := c.localURL()
+	if err != nil {
+		return err
+	}
+	u := base + "/ack?" + c.query(instance, 0, ack.Time.Add(time.Minute)).Encode()
+	form := url.Values{}
+	form.Set("by", ack.By)
+	form.Set("comment", ack.Comment)
+	form.Set("format", "text")
+	resp, err := daemonClient.PostForm(u, form)
+	if err != nil {
+		return fmt.Errorf("request daemon error, is the daemon running: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+//读取检查状态
+func (t *Tracker) State(typ string, name string) (CheckState, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.store.Get(stateKey(typ, name))
+}
+
+//本次故障是否已确认，确认后停止重复通知及升级
+func (s CheckState) acknowledged() bool {
+	return s.Ack != nil
+}
+
+//确认故障，停止重复通知及升级；实例不在故障状态或已确认时返回错误
+func (t *Tracker) Ack(typ string, name string, ack Ack) (CheckState, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	key := stateKey(typ, name)
+	s, ok := t.store.Get(key)
+	if !ok || s.State != StateFailing {
+		return s, fmt.Errorf("%s is not failing", key)
+	}
+	if s.acknowledged() {
+		return s, fmt.Errorf("%s already acknowledged by %s at %s", key, s.Ack.By, s.Ack.Time.Format("2006-01-02 15:04:05"))
+	}
+	s.Ack = &ack
+	t.store.Put(key, s)
+	return s, nil
+}
+
+//按名称或“类型/名称”查找实例
+func (m *Monitor) findChecker(instance string) (Checker, error) {
+	var found []Checker
+	for _, c := range m.Checkers {
+		if stateKey(c.Type(), c.Name()) == instance {
+			return c, nil
+		}
+		if c.Name() == instance {
+			found = append(found, c)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("unknown instance %q", instance)
+	case 1:
+		return found[0], nil
+	default:
+		return nil, fmt.Errorf("instance name %q is ambiguous, use type/name", instance)
+	}
+}
+
+//实例最近的检查结果，本进程尚未检查时根据保存的状态构造
+func (m *Monitor) resultOf(c Checker, s CheckState) Result {
+	m.latestLock.Lock()
+	r, ok := m.latest[stateKey(c.Type(), c.Name())]
+	m.latestLock.Unlock()
+	if ok {
+		return r
+	}
+	r = Result{Name: c.Name(), Type: c.Type(), Target: TargetOf(c), Status: s.LastStatus, Time: s.LastCheck, Info: AlertInfo{}.withDefaults()}
+	if ai, ok := c.(AlertInfoer); ok {
+		r.Info = ai.AlertInfo()
+	}
+	return r
+}
+
+//确认实例当前的故障并通知，instance为名称或“类型/名称”
+func (m *Monitor) Ack(instance string, ack Ack) error {
+	c, err := m.findChecker(instance)
+	if err != nil {
+		return err
+	}
+	return m.ack(c, ack, 0)
+}
+
+//确认故障，incident不为0时要求实例当前的故障开始于该时间
+func (m *Monitor) ack(c Checker, ack Ack, incident int64) error {
+	if ack.Time.IsZero() {
+		ack.Time = time.Now()
+	}
+	if ack.By == "" {
+		ack.By = "anonymous"
+	}
+	if incident != 0 {
+		if s, ok := m.tracker.State(c.Type(), c.Name()); !ok || s.State != StateFailing || s.FirstFailure.UnixNano() != incident {
+			return errors.New("incident already ended")
+		}
+	}
+	s, err := m.tracker.Ack(c.Type(), c.Name(), ack)
+	if err != nil {
+		return err
+	}
+	log.Infof("%s acknowledged by %s: %s", stateKey(c.Type(), c.Name()), ack.By, ack.Comment)
+	e := Event{Kind: EventAcked, Result: m.resultOf(c, s), Failures: s.ConsecutiveFailures, Downtime: ack.Time.Sub(s.FirstFailure), Escalation: s.Escalated, Ack: &ack}
+	m.send(context.Background(), []Message{m.templates.message(e)})
+	m.saveState()
+	return nil
+}
+
+//为需要处理的故障消息附加确认链接
+func (m *Monitor) ackLink(msg Message) Message {
+	switch msg.Event.Kind {
+	case EventFailing, EventRepeat, EventEscalated:
+	default:
+		return msg
+	}
+	r := msg.Event.Result
+	if s, ok := m.tracker.State(r.Type, r.Name); ok && s.State == StateFailing {
+		msg.AckURL = m.Conf.Ack.Link(stateKey(r.Type, r.Name), s.FirstFailure, time.Now())
+	}
+	return msg
+}
+
+//确认接口：GET展示确认页面，POST确认故障；请求需带有效的签名参数
+func (m *Monitor) ackHandler(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	instance, incident, err := m.Conf.Ack.verify(req.Form, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	c, err := m.findChecker(instance)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	s, _ := m.tracker.State(c.Type(), c.Name())
+	r := m.resultOf(c, s)
+	page := map[string]string{"Title": m.templates.title(r), "Error": r.Message}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		if s.State == StateFailing {
+			page["Downtime"] = humanDuration(time.Since(s.FirstFailure))
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, m.templates.render("ack.form", page))
+	case http.MethodPost:
+		err = m.ack(c, Ack{By: req.FormValue("by"), Comment: req.FormValue("comment")}, incident)
+		if req.FormValue("format") == "text" {
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusConflict)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		page["Error"] = ""
+		if err != nil {
+			page["Error"] = err.Error()
+			w.WriteHeader(http.StatusConflict)
+		}
+		fmt.Fprint(w, m.templates.render("ack.done", page))
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+//守护进程模式下运行确认及静默接口，ctx结束时关闭
+func (m *Monitor) serveHTTP(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ack", m.ackHandler)
+	mux.HandleFunc("/silences", m.silencesHandler)
+	server := &http.Server{Addr: m.Conf.Ack.Listen, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+	log.Infof("HTTP endpoint listening on %s", m.Conf.Ack.Listen)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Errorf("HTTP endpoint error: %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package monitor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//结果可控的检查器
+type fakeChecker struct {
+	name   string
+	status Status
+}
+
+func (c *fakeChecker) Name() string { return c.name }
+func (c *fakeChecker) Type() string { return "fake" }
+func (c *fakeChecker) Check(ctx context.Context) Result {
+	return Result{Name: c.name, Type: "fake", Target: "127.0.0.1:1", Status: c.status, Message: "连接被拒绝"}
+}
+
+//记录收到的消息的通知渠道
+type recordNotifier struct {
+	lock sync.Mutex
+	msgs []Message
+}
+
+func (n *recordNotifier) Name() string { return "record" }
+func (n *recordNotifier) Notify(msgs []Message) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.msgs = append(n.msgs, msgs...)
+	return nil
+}
+
+func (n *recordNotifier) drain() []Message {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	msgs := n.msgs
+	n.msgs = nil
+	return msgs
+}
+
+func newAckMonitor(c Checker, n Notifier) *Monitor {
+	conf := &Conf{Ack: AckConf{URL: "https://monitor.example.com/", Secret: "s3cret"}}
+	m := &Monitor{Conf: conf, Checkers: []Checker{c}, slots: make(chan struct{}, 1), notifiers: []Notifier{n}, latest: map[string]Result{}}
+	m.UseStore(NewMemoryStore())
+	return m
+}
+
+func TestAckLink(t *testing.T) {
+	c := AckConf{URL: "https://monitor.example.com", Secret: "s3cret"}
+	now := time.Now()
+	incident := now.Add(-time.Hour)
+	link, err := url.Parse(c.Link("mysql/MySQL", incident, now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Host != "monitor.example.com" || link.Path != "/ack" {
+		t.Errorf("link = %s", link)
+	}
+	instance, got, err := c.verify(link.Query(), now)
+	if err != nil || instance != "mysql/MySQL" || got != incident.UnixNano() {
+		t.Errorf("verify = %q, %d, %v", instance, got, err)
+	}
+	if _, _, err = c.verify(link.Query(), now.Add(DefaultAckLinkTTL+time.Minute)); err == nil {
+		t.Error("expired link should fail")
+	}
+	query := link.Query()
+	query.Set("i", "mysql/Other")
+	if _, _, err = c.verify(query, now); err == nil {
+		t.Error("tampered link should fail")
+	}
+	if (AckConf{Secret: "s3cret"}).Link("mysql/MySQL", incident, now) != "" {
+		t.Error("link without url should be empty")
+	}
+}
+
+//只能确认故障中且未确认的实例
+func TestTrackerAck(t *testing.T) {
+	tracker := NewTracker(NewMemoryStore())
+	policy := AlertPolicy{FailuresBeforeAlert: 1, SuccessesBeforeRecovery: 1}
+	start := time.Date(2024, 1, 1, 8, 0, 0, 0, time.Local)
+	if _, err := tracker.Ack("mysql", "MySQL", Ack{Time: start}); err == nil {
+		t.Error("ack of unknown instance should fail")
+	}
+	tracker.Update(Result{Name: "MySQL", Type: "mysql", Status: StatusFailed, Time: start}, policy)
+	s, err := tracker.Ack("mysql", "MySQL", Ack{Time: start.Add(time.Minute), By: "alice"})
+	if err != nil || !s.acknowledged() || s.Ack.By != "alice" {
+		t.Fatalf("ack = %+v, %v", s, err)
+	}
+	if _, err = tracker.Ack("mysql", "MySQL", Ack{Time: start.Add(2 * time.Minute)}); err == nil {
+		t.Error("second ack should fail")
+	}
+	//恢复后清除确认，新的故障可再次确认
+	tracker.Update(Result{Name: "MySQL", Type: "mysql", Status: StatusOK, Time: start.Add(3 * time.Minute)}, policy)
+	if _, err = tracker.Ack("mysql", "MySQL", Ack{Time: start.Add(4 * time.Minute)}); err == nil {
+		t.Error("ack after recovery should fail")
+	}
+	tracker.Update(Result{Name: "MySQL", Type: "mysql", Status: StatusFailed, Time: start.Add(5 * time.Minute)}, policy)
+	if _, err = tracker.Ack("mysql", "MySQL", Ack{Time: start.Add(6 * time.Minute)}); err != nil {
+		t.Errorf("ack of new incident: %v", err)
+	}
+}
+
+func TestAckHandler(t *testing.T) {
+	c := &fakeChecker{name: "MySQL", status: StatusFailed}
+	n := &recordNotifier{}
+	m := newAckMonitor(c, n)
+	m.Check(context.Background(), c)
+	m.Flush()
+	msgs := n.drain()
+	if len(msgs) != 1 || msgs[0].AckURL == "" {
+		t.Fatalf("failing messages = %+v", msgs)
+	}
+	link, _ := url.Parse(msgs[0].AckURL)
+
+	server := httptest.NewServer(http.HandlerFunc(m.ackHandler))
+	defer server.Close()
+	ackURL := server.URL + "/ack?" + link.RawQuery
+
+	resp, err := http.Get(ackURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(n.drain()) != 0 {
+		t.Fatalf("GET status = %d, GET should not acknowledge", resp.StatusCode)
+	}
+	resp, err = http.PostForm(ackURL, url.Values{"by": {"alice"}, "comment": {"正在处理"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST status = %d", resp.StatusCode)
+	}
+	msgs = n.drain()
+	if len(msgs) != 1 || msgs[0].Event.Kind != EventAcked || !strings.Contains(msgs[0].Content, "alice已确认故障: 正在处理") {
+		t.Fatalf("acked messages = %+v", msgs)
+	}
+	resp, _ = http.PostForm(ackURL, url.Values{"by": {"bob"}})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("second ack status = %d, want 409", resp.StatusCode)
+	}
+
+	//恢复消息带上确认备注，之后旧链接失效
+	c.status = StatusOK
+	m.Check(context.Background(), c)
+	m.Flush()
+	msgs = n.drain()
+	if len(msgs) != 1 || !strings.Contains(msgs[0].Content, "（alice已确认: 正在处理）") {
+		t.Fatalf("recovered messages = %+v", msgs)
+	}
+	c.status = StatusFailed
+	m.Check(context.Background(), c)
+	resp, _ = http.PostForm(ackURL, url.Values{"by": {"alice"}})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("ack of ended incident status = %d, want 409", resp.StatusCode)
+	}
+	resp, _ = http.Get(server.URL + "/ack?i=fake/MySQL&incident=0&expires=9999999999&sig=00")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("unsigned request status = %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestMonitorAck(t *testing.T) {
+	c := &fakeChecker{name: "Redis", status: StatusFailed}
+	n := &recordNotifier{}
+	m := newAckMonitor(c, n)
+	if err := m.Ack("Redis", Ack{By: "alice"}); err == nil {
+		t.Error("ack before failure should fail")
+	}
+	m.Check(context.Background(), c)
+	m.Flush()
+	n.drain()
+	if err := m.Ack("Nope", Ack{}); err == nil {
+		t.Error("unknown instance should fail")
+	}
+	if err := m.Ack("fake/Redis", Ack{By: "alice", Comment: "重启中"}); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := n.drain(); len(msgs) != 1 || msgs[0].Event.Ack == nil || msgs[0].Event.Ack.Comment != "重启中" {
+		t.Fatalf("acked messages = %+v", msgs)
+	}
+	//确认后不再重复通知
+	s, _ := m.tracker.State("fake", "Redis")
+	if e, ok := m.tracker.Update(Result{Name: "Redis", Type: "fake", Status: StatusFailed, Time: s.LastCheck.Add(24 * time.Hour)}, AlertPolicy{RepeatInterval: time.Minute}); ok {
+		t.Errorf("repeat after ack = %v", e.Kind)
+	}
+}
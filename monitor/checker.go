@@ -0,0 +1,245 @@
+// checker
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+//检查器
+type Checker interface {
+	//实例名称
+	Name() string
+	//检查类型，与配置instances下的键一致，如http、mysql
+	Type() string
+	//执行一次检查，需遵守ctx的超时与取消
+	Check(ctx context.Context) Result
+}
+
+//可选接口：声明检查目标，用于告警展示
+type Targeter interface {
+	Target() string
+}
+
+//可选接口：声明检查间隔，未实现时使用全局间隔
+type Intervaler interface {
+	Interval() time.Duration
+}
+
+//检查结果状态
+type Status int
+
+const (
+	StatusOK Status = iota
+	StatusFailed
+	StatusTimeout
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusOK:
+		return "ok"
+	case StatusTimeout:
+		return "timeout"
+	default:
+		return "failed"
+	}
+}
+
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Status) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "ok":
+		*s = StatusOK
+	case "timeout":
+		*s = StatusTimeout
+	case "failed":
+		*s = StatusFailed
+	default:
+		return fmt.Errorf("unknown status %q", text)
+	}
+	return nil
+}
+
+//检查结果
+type Result struct {
+	Name   string
+	Type   string
+	Target string
+	Status Status
+	//结果描述，失败时作为告警内容
+	Message string
+	Err     error `json:"-"`
+	//检查开始时间及耗时（含重试）
+	Time     time.Time
+	Duration time.Duration
+	//尝试次数
+	Attempts int
+	//实例的告警附加信息
+	Info AlertInfo
+	//生成Message的check.*模板名称后缀，检查器自行设置Message时为空
+	reason string
+}
+
+//告警标题，如 "HTTP -> Nginx【http://127.0.0.1】"，见title模板，使用默认语言
+func (r Result) Title() string {
+	return defaultTemplates.title(r)
+}
+
+//告警标题
+func (t *Templates) title(r Result) string {
+	return t.render("title", t.resultData(r))
+}
+
+//检查结果信息，由check.<reason>模板生成，检查器自行设置的信息原样返回
+func (t *Templates) checkText(r Result) string {
+	if r.reason == "" {
+		return r.Message
+	}
+	var data TemplateData
+	if r.Err != nil {
+		data.Error = r.Err.Error()
+	}
+	return t.render("check."+r.reason, data)
+}
+
+//检查是否通过
+func (r Result) OK() bool {
+	return r.Status == StatusOK
+}
+
+//检查器工厂，根据配置生成该类型的全部检查器
+type Factory func(conf *Conf) []Checker
+
+var (
+	registryLock sync.RWMutex
+	registry     = map[string]Factory{}
+	typeLabels   = map[string]string{}
+)
+
+//注册检查类型，label为告警中展示的类型名称
+func Register(typ string, label string, factory Factory) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registry[typ] = factory
+	typeLabels[typ] = label
+}
+
+//已注册的检查类型
+func Types() []string {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	types := make([]string, 0, len(registry))
+	for typ := range registry {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	return types
+}
+
+//类型展示名称，未注册时使用大写类型名
+func TypeLabel(typ string) string {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	if label, ok := typeLabels[typ]; ok {
+		return label
+	}
+	return strings.ToUpper(typ)
+}
+
+//根据配置生成检查器，types为空时生成全部已注册类型
+func NewCheckers(conf *Conf, types ...string) []Checker {
+	if len(types) == 0 {
+		types = Types()
+	}
+	var checkers []Checker
+	for _, typ := range types {
+		registryLock.RLock()
+		factory, ok := registry[typ]
+		registryLock.RUnlock()
+		if ok {
+			checkers = append(checkers, factory(conf)...)
+		}
+	}
+	return checkers
+}
+
+//检查目标，未实现Targeter时为空
+func TargetOf(c Checker) string {
+	if t, ok := c.(Targeter); ok {
+		return t.Target()
+	}
+	return ""
+}
+
+//内置检查器的公共字段
+type base struct {
+	name     string
+	target   string
+	interval time.Duration
+	timeout  Timeout
+	policy   AlertPolicy
+	info     AlertInfo
+}
+
+func (b *base) Name() string            { return b.name }
+func (b *base) Target() string          { return b.target }
+func (b *base) Interval() time.Duration { return b.interval }
+func (b *base) Policy() AlertPolicy     { return b.policy }
+func (b *base) AlertInfo() AlertInfo    { return b.info }
+
+//成功结果
+func (b *base) ok(typ string) Result {
+	r := Result{Name: b.name, Type: typ, Target: b.target, Status: StatusOK, reason: "ok"}
+	r.Message = defaultTemplates.checkText(r)
+	return r
+}
+
+//失败结果，信息由check.<reason>模板生成（Monitor按配置的语言重新生成）：超时、连接被拒绝与其他异常分开标记
+func (b *base) fail(typ string, reason string, err error) Result {
+	r := Result{Name: b.name, Type: typ, Target: b.target, Status: StatusFailed, Err: err}
+	if isTimeout(err) {
+		r.Status = StatusTimeout
+		reason = "timeout"
+	} else if isRefused(err) {
+		reason = "refused"
+	}
+	r.reason = reason
+	r.Message = defaultTemplates.checkText(r)
+	return r
+}
+
+//是否为超时错误
+func isTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+//ctx已结束时返回ctx的错误，便于识别超时
+func ctxErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+//是否为连接被拒绝
+func isRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
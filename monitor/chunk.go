@@ -0,0 +1,182 @@
+// chunk
+package monitor
+
+import (
+	"context"
+	"errors"
+	"unicode/utf8"
+)
+
+//拆分后的一条消息
+type msgChunk struct {
+	msgs []Message
+	//序号，如“（1/3）”，只有一条时为空
+	part string
+	//超出条数限制未展示的消息，汇总在最后一条中
+	overflow []Message
+}
+
+//按级别排序，严重的消息在前
+func sortBySeverity(msgs []Message) []Message {
+	var sorted []Message
+	for _, g := range GroupBySeverity(msgs) {
+		sorted = append(sorted, g.Msgs...)
+	}
+	return sorted
+}
+
+//按顺序拆分为消息体不超过maxBytes的多条消息，超过maxChunks条时其余消息汇总到最后一条；
+//size返回一条消息的消息体字节数
+func splitChunks(t *Templates, msgs []Message, maxBytes int, maxChunks int, size func(msgChunk) int) []msgChunk {
+	//按最长的序号估算大小
+	sizeOf := func(c msgChunk) int {
+		if c.part == "" {
+			c.part = t.partText(99, 99)
+		}
+		return size(c)
+	}
+	var chunks []msgChunk
+	var cur []Message
+	for i, msg := range msgs {
+		msg = truncateMsg(t, msg, maxBytes, sizeOf)
+		if len(cur) > 0 && sizeOf(msgChunk{msgs: append(cur[:len(cur):len(cur)], msg)}) > maxBytes {
+			chunks = append(chunks, msgChunk{msgs: cur})
+			cur = nil
+			if len(chunks) == maxChunks {
+				last := &chunks[len(chunks)-1]
+				last.overflow = msgs[i:]
+				//汇总行放不下时把最后一条也移入汇总
+				for len(last.msgs) > 1 && sizeOf(*last) > maxBytes {
+					last.overflow = append([]Message{last.msgs[len(last.msgs)-1]}, last.overflow...)
+					last.msgs = last.msgs[:len(last.msgs)-1]
+				}
+				break
+			}
+		}
+		cur = append(cur, msg)
+	}
+	if len(cur) > 0 {
+		chunks = append(chunks, msgChunk{msgs: cur})
+	}
+	if len(chunks) > 1 {
+		for i := range chunks {
+			chunks[i].part = t.partText(i+1, len(chunks))
+		}
+	}
+	return chunks
+}
+
+//单条消息超过大小限制时截断内容
+func truncateMsg(t *Templates, msg Message, maxBytes int, size func(msgChunk) int) Message {
+	suffix := t.render("batch.truncated", nil)
+	over := size(msgChunk{msgs: []Message{msg}}) - maxBytes
+	if over <= 0 {
+		return msg
+	}
+	//json转义可能使字节数放大，多截一些
+	content := []byte(msg.Content)
+	keep := len(content) - over*2 - len(suffix)
+	if keep < 0 {
+		keep = 0
+	}
+	for keep > 0 && !utf8.RuneStart(content[keep]) {
+		keep--
+	}
+	msg.Content = string(content[:keep]) + suffix
+	return msg
+}
+
+//按限流（limiter为nil时不限流）依次发送各条消息，ctx结束时停止等待；部分送达后失败时，返回的DeliveryError中记录剩余未送达的消息
+func sendChunks(ctx context.Context, chunks []msgChunk, limiter *rateLimiter, send func(msgChunk) error) error {
+	for i, c := range chunks {
+		var err error
+		if limiter != nil {
+			err = limiter.wait(ctx)
+		}
+		if err == nil {
+			err = send(c)
+		}
+		if err == nil {
+			continue
+		}
+		if i == 0 {
+			return err
+		}
+		//已送达部分不再重发
+		var rest []Message
+		for _, c := range chunks[i:] {
+			rest = append(append(rest, c.msgs...), c.overflow...)
+		}
+		de := &DeliveryError{Err: err, Temporary: true, Rest: rest}
+		var e *DeliveryError
+		if errors.As(err, &e) {
+			de.Temporary, de.RateLimited = e.Temporary, e.RateLimited
+		}
+		return de
+	}
+	return nil
+}
+
+//未展示消息的汇总，如“还有37个故障未展示”
+func (t *Templates) overflowText(msgs []Message) string {
+	var failures, others int
+	for _, msg := range msgs {
+		if msg.Severity() == "recovered" || msg.Event.Kind == EventSummary {
+			others++
+		} else {
+			failures++
+		}
+	}
+	return t.render("batch.overflow", map[string]int{"Failures": failures, "Others": others})
+}
+
+//拆分后的序号，如“（1/3）”
+func (t *Templates) partText(index int, total int) string {
+	return t.render("batch.part", map[string]int{"Index": index, "Total": total})
+}
+
+//一条消息的标题，如“服务监控：严重2 已恢复1”，拆分时带序号
+func (t *Templates) batchTitle(c msgChunk) string {
+	var counts []map[string]interface{}
+	for _, g := range GroupBySeverity(c.msgs) {
+		counts = append(counts, map[string]interface{}{"Severity": g.Severity, "Label": t.severityLabel(g.Severity), "Count": len(g.Msgs)})
+	}
+	return t.render("batch.title", map[string]interface{}{"Part": c.part, "Counts": counts})
+}
+
+//级别分组的标题，如“严重（2）”
+func (t *Templates) groupTitle(g SeverityGroup) string {
+	return t.render("batch.group", map[string]interface{}{"Label": t.severityLabel(g.Severity), "Count": len(g.Msgs)})
+}
+
+//实例名及类型，如“Nginx（HTTP）”，name可带格式
+func (t *Templates) instanceText(name string, r Result) string {
+	return t.render("batch.instance", map[string]string{"Name": name, "Type": TypeLabel(r.Type)})
+}
+
+//消息中的固定文字，见label.*模板
+func (t *Templates) labelText(name string) string {
+	return t.render("label."+name, nil)
+}
+
+//一条消息占一行的文字，见line.*模板；markdown渠道中bold为true，实例名加粗
+func (t *Templates) lineText(name string, msg Message, bold bool) string {
+	r := msg.Event.Result
+	data := LineData{Title: msg.Title, Content: msg.Content, Name: r.Name, Target: r.Target, Runbook: r.Info.Runbook, AckURL: msg.AckURL}
+	if r.Name != "" {
+		instance := r.Name
+		if bold {
+			instance = "**" + r.Name + "**"
+		}
+		data.Instance = t.instanceText(instance, r)
+	}
+	return t.render(name, data)
+}
+
+//大于0时返回v，否则返回默认值
+func positive(v int, def int) int {
+	if v > 0 {
+		return v
+	}
+	return def
+}
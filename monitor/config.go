@@ -0,0 +1,363 @@
+// config
+package monitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	//未配置interval时的默认检查间隔
+	DefaultInterval = time.Minute
+	//默认并发检查数
+	DefaultWorkers = 10
+	//默认建立连接超时
+	DefaultConnectTimeout = 5 * time.Second
+	//默认单次检查总超时
+	DefaultTotalTimeout = 10 * time.Second
+	//ping检查默认发送的请求数
+	DefaultPingCount = 3
+)
+
+//配置
+type Conf struct {
+	Enabled bool `yaml:"enabled"`
+	//默认检查间隔，守护进程模式下实例未配置interval时使用
+	Interval time.Duration `yaml:"interval"`
+	//并发检查数
+	Workers int `yaml:"workers"`
+	//默认超时
+	Timeout Timeout `yaml:"timeout"`
+	//默认告警策略
+	PolicyConf `yaml:",inline"`
+	//检查状态存储
+	State     StateConf `yaml:"state"`
+	Instances Instances `yaml:"instances"`
+	//通知渠道
+	Notifiers []NotifierConf `yaml:"notifiers"`
+	//按实例标签、检查类型及告警级别选择通知渠道
+	Routes RouteConf `yaml:"routes"`
+	//故障确认接口及链接
+	Ack AckConf `yaml:"ack"`
+	//静默（维护窗口），期间匹配的实例照常检查但不发送通知
+	Silences []Silence `yaml:"silences"`
+	//通知发送的超时、重试及未送达消息暂存
+	Delivery DeliveryConf `yaml:"delivery"`
+	//报告模式：failures_only（默认）、always、digest，digest_time为每日汇总时间
+	ReportMode string `yaml:"report_mode"`
+	DigestTime string `yaml:"digest_time"`
+	//告警文案语言：zh-CN（默认）、en-US，templates为自定义模板目录，其中的*.tmpl按文件名覆盖同名模板
+	Language  string `yaml:"language"`
+	Templates string `yaml:"templates"`
+	//钉钉机器人token，兼容旧配置，等同一个名为dingtalk的钉钉渠道
+	DdRobotToken string `yaml:"ddRobotToken"`
+	//钉钉机器人加签密钥及自定义关键词
+	DdRobotSecret  string `yaml:"ddRobotSecret"`
+	DdRobotKeyword string `yaml:"ddRobotKeyword"`
+}
+
+//实例配置
+type Instances struct {
+	Http  []HttpInstance  `yaml:"http"`
+	Mysql []MysqlInstance `yaml:"mysql"`
+	Redis []RedisInstance `yaml:"redis"`
+	TCP   []TCPInstance   `yaml:"tcp"`
+	Ping  []PingInstance  `yaml:"ping"`
+	//其他类型的实例，供自定义检查器通过DecodeInstances读取
+	Custom map[string]interface{} `yaml:",inline"`
+}
+
+//Http实例
+type HttpInstance struct {
+	Name         string        `yaml:"name"`
+	Url          string        `yaml:"url"`
+	Username     string        `yaml:"username"`
+	Password     string        `yaml:"password"`
+	ContentMatch string        `yaml:"content_match"`
+	StatusCode   int           `yaml:"status_code"`
+	Interval     time.Duration `yaml:"interval"`
+	Timeout      Timeout       `yaml:"timeout"`
+	PolicyConf   `yaml:",inline"`
+	AlertInfo    `yaml:",inline"`
+}
+
+//MySQL实例
+type MysqlInstance struct {
+	Name       string        `yaml:"name"`
+	Host       string        `yaml:"host"`
+	User       string        `yaml:"user"`
+	Pass       string        `yaml:"pass"`
+	Port       string        `yaml:"port"`
+	Interval   time.Duration `yaml:"interval"`
+	Timeout    Timeout       `yaml:"timeout"`
+	PolicyConf `yaml:",inline"`
+	AlertInfo  `yaml:",inline"`
+}
+
+//Redis实例
+type RedisInstance struct {
+	Name       string        `yaml:"name"`
+	Host       string        `yaml:"host"`
+	Pass       string        `yaml:"pass"`
+	Port       string        `yaml:"port"`
+	Interval   time.Duration `yaml:"interval"`
+	Timeout    Timeout       `yaml:"timeout"`
+	PolicyConf `yaml:",inline"`
+	AlertInfo  `yaml:",inline"`
+}
+
+//TCP实例
+type TCPInstance struct {
+	Name       string        `yaml:"name"`
+	Host       string        `yaml:"host"`
+	Port       string        `yaml:"port"`
+	Interval   time.Duration `yaml:"interval"`
+	Timeout    Timeout       `yaml:"timeout"`
+	PolicyConf `yaml:",inline"`
+	AlertInfo  `yaml:",inline"`
+}
+
+//主机ping实例
+type PingInstance struct {
+	Name string `yaml:"name"`
+	Host string `yaml:"host"`
+	//每次检查发送的请求数，默认3
+	Count      int           `yaml:"count"`
+	Interval   time.Duration `yaml:"interval"`
+	Timeout    Timeout       `yaml:"timeout"`
+	PolicyConf `yaml:",inline"`
+	AlertInfo  `yaml:",inline"`
+}
+
+//超时配置，connect为建立连接超时，total为单次检查总超时
+type Timeout struct {
+	Connect time.Duration `yaml:"connect"`
+	Total   time.Duration `yaml:"total"`
+}
+
+//按顺序读取配置文件，使用第一个存在的文件
+func LoadConf(files ...string) (*Conf, error) {
+	var (
+		yamlFile []byte
+		err      error
+	)
+	for _, file := range files {
+		yamlFile, err = ioutil.ReadFile(file)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	conf := &Conf{}
+	if err = yaml.Unmarshal(yamlFile, conf); err != nil {
+		return nil, fmt.Errorf("unmarshal config: %v", err)
+	}
+	return conf, nil
+}
+
+//将自定义类型的实例配置解析到out
+func (conf *Conf) DecodeInstances(typ string, out interface{}) error {
+	raw, ok := conf.Instances.Custom[typ]
+	if !ok {
+		return nil
+	}
+	data, err := yaml.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(data, out)
+}
+
+//实例间隔 > 全局间隔 > 默认间隔
+func (conf *Conf) IntervalOf(interval time.Duration) time.Duration {
+	if interval > 0 {
+		return interval
+	}
+	if conf.Interval > 0 {
+		return conf.Interval
+	}
+	return DefaultInterval
+}
+
+//实例超时 > 全局超时 > 默认超时，connect不超过total
+func (conf *Conf) TimeoutOf(t Timeout) Timeout {
+	if t.Connect <= 0 {
+		t.Connect = conf.Timeout.Connect
+	}
+	if t.Connect <= 0 {
+		t.Connect = DefaultConnectTimeout
+	}
+	if t.Total <= 0 {
+		t.Total = conf.Timeout.Total
+	}
+	if t.Total <= 0 {
+		t.Total = DefaultTotalTimeout
+	}
+	if t.Connect > t.Total {
+		t.Connect = t.Total
+	}
+	return t
+}
+
+//校验配置，返回发现的全部问题
+func (conf *Conf) Validate() []error {
+	var errs []error
+	seen := map[string]bool{}
+	checkInfo := func(typ string, name string, info AlertInfo) {
+		switch info.Severity {
+		case "", SeverityCritical, SeverityWarning, SeverityInfo:
+		default:
+			errs = append(errs, fmt.Errorf("%s %q: unknown severity %q", typ, name, info.Severity))
+		}
+		if info.Runbook != "" {
+			if u, err := url.Parse(info.Runbook); err != nil || u.Scheme == "" || u.Host == "" {
+				errs = append(errs, fmt.Errorf("%s %q: invalid runbook url %q", typ, name, info.Runbook))
+			}
+		}
+	}
+	//抖动检测：窗口不能为负，阈值为0~100的百分比，退出阈值不能高于进入阈值；prefix为空时为全局配置
+	checkPolicy := func(prefix string, p PolicyConf) {
+		if p.FlapWindow != nil && *p.FlapWindow < 0 {
+			errs = append(errs, fmt.Errorf("%sflap_window must not be negative", prefix))
+		}
+		for _, t := range []struct {
+			key   string
+			value *float64
+		}{{"flap_high_threshold", p.FlapHighThreshold}, {"flap_low_threshold", p.FlapLowThreshold}} {
+			if t.value != nil && (*t.value < 0 || *t.value > 100) {
+				errs = append(errs, fmt.Errorf("%s%s must be between 0 and 100", prefix, t.key))
+			}
+		}
+		//实例未配置阈值时沿用全局配置，已在全局检查
+		if p.FlapHighThreshold == nil && p.FlapLowThreshold == nil {
+			return
+		}
+		if policy := conf.PolicyOf(p); policy.FlapLowThreshold > policy.FlapHighThreshold {
+			errs = append(errs, fmt.Errorf("%sflap_low_threshold %v is higher than flap_high_threshold %v", prefix, policy.FlapLowThreshold, policy.FlapHighThreshold))
+		}
+	}
+	checkPolicy("", conf.PolicyConf)
+	checkName := func(typ string, name string) {
+		if name == "" {
+			errs = append(errs, fmt.Errorf("%s: instance without name", typ))
+			return
+		}
+		if seen[typ+"/"+name] {
+			errs = append(errs, fmt.Errorf("%s %q: duplicate name", typ, name))
+		}
+		seen[typ+"/"+name] = true
+	}
+	checkAddr := func(typ string, name string, host string, port string) {
+		if host == "" {
+			errs = append(errs, fmt.Errorf("%s %q: host is empty", typ, name))
+		}
+		if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+			errs = append(errs, fmt.Errorf("%s %q: invalid port %q", typ, name, port))
+		}
+	}
+	for _, inst := range conf.Instances.Http {
+		checkName("http", inst.Name)
+		checkInfo("http", inst.Name, inst.AlertInfo)
+		checkPolicy(fmt.Sprintf("http %q: ", inst.Name), inst.PolicyConf)
+		if u, err := url.Parse(inst.Url); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("http %q: invalid url %q", inst.Name, inst.Url))
+		}
+		if inst.ContentMatch != "" {
+			if _, err := regexp.Compile(inst.ContentMatch); err != nil {
+				errs = append(errs, fmt.Errorf("http %q: invalid content_match: %v", inst.Name, err))
+			}
+		}
+	}
+	for _, inst := range conf.Instances.Mysql {
+		checkName("mysql", inst.Name)
+		checkInfo("mysql", inst.Name, inst.AlertInfo)
+		checkPolicy(fmt.Sprintf("mysql %q: ", inst.Name), inst.PolicyConf)
+		checkAddr("mysql", inst.Name, inst.Host, inst.Port)
+	}
+	for _, inst := range conf.Instances.Redis {
+		checkName("redis", inst.Name)
+		checkInfo("redis", inst.Name, inst.AlertInfo)
+		checkPolicy(fmt.Sprintf("redis %q: ", inst.Name), inst.PolicyConf)
+		checkAddr("redis", inst.Name, inst.Host, inst.Port)
+	}
+	for _, inst := range conf.Instances.TCP {
+		checkName("tcp", inst.Name)
+		checkInfo("tcp", inst.Name, inst.AlertInfo)
+		checkPolicy(fmt.Sprintf("tcp %q: ", inst.Name), inst.PolicyConf)
+		checkAddr("tcp", inst.Name, inst.Host, inst.Port)
+	}
+	for _, inst := range conf.Instances.Ping {
+		checkName("ping", inst.Name)
+		checkInfo("ping", inst.Name, inst.AlertInfo)
+		checkPolicy(fmt.Sprintf("ping %q: ", inst.Name), inst.PolicyConf)
+		if inst.Host == "" {
+			errs = append(errs, fmt.Errorf("ping %q: host is empty", inst.Name))
+		}
+	}
+	switch conf.ReportMode {
+	case "", ReportFailuresOnly, ReportAlways, ReportDigest:
+	default:
+		errs = append(errs, fmt.Errorf("unknown report_mode %q", conf.ReportMode))
+	}
+	if conf.DigestTime != "" {
+		if _, err := time.Parse("15:04", conf.DigestTime); err != nil {
+			errs = append(errs, fmt.Errorf("invalid digest_time %q, want HH:MM", conf.DigestTime))
+		}
+	}
+	if _, err := LoadTemplates(conf.Language, conf.Templates); err != nil {
+		errs = append(errs, fmt.Errorf("load templates error: %v", err))
+	}
+	if conf.Workers < 0 {
+		errs = append(errs, fmt.Errorf("workers must not be negative"))
+	}
+	ncs := conf.NotifierConfs()
+	if len(ncs) == 0 {
+		errs = append(errs, fmt.Errorf("no notifier configured"))
+	}
+	names := map[string]bool{}
+	for _, nc := range ncs {
+		if nc.Name == "" {
+			errs = append(errs, fmt.Errorf("notifier without name"))
+		} else if names[nc.Name] {
+			errs = append(errs, fmt.Errorf("notifier %q: duplicate name", nc.Name))
+		}
+		names[nc.Name] = true
+		if !nc.IsEnabled() {
+			continue
+		}
+		if _, err := NewNotifier(nc); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	errs = append(errs, conf.Routes.validate(names)...)
+	if (conf.Ack.Listen != "" || conf.Ack.URL != "") && conf.Ack.Secret == "" {
+		errs = append(errs, fmt.Errorf("ack: secret is required"))
+	}
+	if conf.Ack.Listen != "" {
+		if _, _, err := net.SplitHostPort(conf.Ack.Listen); err != nil {
+			errs = append(errs, fmt.Errorf("ack: invalid listen %q: %v", conf.Ack.Listen, err))
+		}
+	}
+	_, depErrs := newDependencies(NewCheckers(conf))
+	errs = append(errs, depErrs...)
+	for _, s := range conf.silences() {
+		if err := s.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("silence %q: %v", s.ID, err))
+		}
+	}
+	if conf.Ack.URL != "" {
+		if u, err := url.Parse(conf.Ack.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("ack: invalid url %q", conf.Ack.URL))
+		}
+	}
+	return errs
+}
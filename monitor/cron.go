@@ -0,0 +1,106 @@
+// cron
+package monitor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//cron表达式：分 时 日 月 周（0-7，0和7均为周日），
+//每个字段支持*、数字、范围a-b、步长*/n或a-b/n及逗号分隔的列表
+type cronSpec struct {
+	minute, hour, dom, month, dow uint64
+	//日和周都不是*时，满足其一即匹配
+	domAny, dowAny bool
+}
+
+//各字段取值范围
+var cronBounds = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+func parseCron(expr string) (cronSpec, error) {
+	var spec cronSpec
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return spec, fmt.Errorf("cron %q: want 5 fields (minute hour day month weekday)", expr)
+	}
+	var bits [5]uint64
+	for i, field := range fields {
+		b, err := parseCronField(field, cronBounds[i][0], cronBounds[i][1])
+		if err != nil {
+			return spec, fmt.Errorf("cron %q: %v", expr, err)
+		}
+		bits[i] = b
+	}
+	//7与0均表示周日
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	spec.minute, spec.hour, spec.dom, spec.month, spec.dow = bits[0], bits[1], bits[2], bits[3], bits[4]
+	spec.domAny, spec.dowAny = fields[2] == "*", fields[4] == "*"
+	return spec, nil
+}
+
+//解析单个字段为位集合
+func parseCronField(field string, min int, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part)
+			}
+			rng, step = part[:i], n
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value %q", part)
+				}
+			} else if step > 1 {
+				//a/n表示从a开始到最大值
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("value %q out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+//时间（精确到分钟）是否匹配
+func (c cronSpec) matches(t time.Time) bool {
+	has := func(bits uint64, v int) bool { return bits&(1<<uint(v)) != 0 }
+	if !has(c.minute, t.Minute()) || !has(c.hour, t.Hour()) || !has(c.month, int(t.Month())) {
+		return false
+	}
+	dom, dow := has(c.dom, t.Day()), has(c.dow, int(t.Weekday()))
+	if !c.domAny && !c.dowAny {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+//t是否处于某次开始时间匹配表达式、持续d的时间段内
+func (c cronSpec) within(t time.Time, d time.Duration) bool {
+	start := t.Truncate(time.Minute)
+	for at := start; t.Sub(at) < d; at = at.Add(-time.Minute) {
+		if c.matches(at) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,206 @@
+// delivery
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	//默认发送超时
+	DefaultDeliveryTimeout = 10 * time.Second
+	//默认发送失败重试次数
+	DefaultDeliveryRetries = 3
+	//默认首次重试等待，之后每次翻倍
+	DefaultDeliveryBackoff = time.Second
+	//最长重试等待
+	maxDeliveryBackoff = time.Minute
+	//被限流时的最短等待
+	rateLimitBackoff = 10 * time.Second
+)
+
+//通知发送配置
+type DeliveryConf struct {
+	//单次请求超时
+	Timeout time.Duration `yaml:"timeout"`
+	//失败重试次数及首次重试等待，重试次数未配置时为DefaultDeliveryRetries，为0时不重试
+	Retries *int          `yaml:"retries"`
+	Backoff time.Duration `yaml:"backoff"`
+	//未送达消息的暂存目录，为空时不暂存
+	Outbox string `yaml:"outbox"`
+	//暂存消息的最长保留时间，默认24h
+	OutboxMaxAge time.Duration `yaml:"outbox_max_age"`
+}
+
+//补全默认值
+func (d DeliveryConf) withDefaults() DeliveryConf {
+	if d.Timeout <= 0 {
+		d.Timeout = DefaultDeliveryTimeout
+	}
+	if d.Backoff <= 0 {
+		d.Backoff = DefaultDeliveryBackoff
+	}
+	if d.OutboxMaxAge <= 0 {
+		d.OutboxMaxAge = 24 * time.Hour
+	}
+	return d
+}
+
+//发送失败
+type DeliveryError struct {
+	Err error
+	//是否可重试：网络错误、5xx、限流等可重试，token无效、参数错误等不可重试
+	Temporary bool
+	//是否被限流
+	RateLimited bool
+	//分多条发送时部分送达后剩余未送达的消息，重试时只发送这些；为空表示全部未送达
+	Rest []Message
+}
+
+func (e *DeliveryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DeliveryError) Unwrap() error {
+	return e.Err
+}
+
+//是否可以重试，未知错误按可重试处理
+func retryable(err error) (retry bool, rateLimited bool) {
+	var de *DeliveryError
+	if errors.As(err, &de) {
+		return de.Temporary || de.RateLimited, de.RateLimited
+	}
+	return true, false
+}
+
+//ack、silence命令请求守护进程接口使用的客户端
+var daemonClient = &http.Client{Timeout: DefaultDeliveryTimeout}
+
+//POST及处理响应，返回响应内容；网络错误及非2xx状态返回DeliveryError
+func httpPost(client *http.Client, url string, contentType string, msg string) ([]byte, error) {
+	req, err := http.NewRequest("POST", url, strings.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return httpDo(client, req)
+}
+
+//发送请求及处理响应，返回响应内容；网络错误及非2xx状态返回DeliveryError
+func httpDo(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Error("Post data error ", err)
+		return nil, &DeliveryError{Err: err, Temporary: true}
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Error("Read response error ", err)
+		return nil, &DeliveryError{Err: err, Temporary: true}
+	}
+	log.Info(req.Method, " -> ", resp.Status)
+	log.Info("Response data ", string(body))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return body, &DeliveryError{
+			Err:         fmt.Errorf("unexpected response status %s", resp.Status),
+			Temporary:   resp.StatusCode >= 500,
+			RateLimited: resp.StatusCode == http.StatusTooManyRequests,
+		}
+	}
+	return body, nil
+}
+
+//未送达的消息：错误中记录了部分送达时为剩余消息，否则为全部
+func undelivered(err error, msgs []Message) []Message {
+	var de *DeliveryError
+	if errors.As(err, &de) && len(de.Rest) > 0 {
+		return de.Rest
+	}
+	return msgs
+}
+
+//发送消息，失败时按指数退避重试，被限流时至少等待rateLimitBackoff；ctx结束时不再重试。返回最终未送达的消息
+func deliver(ctx context.Context, n Notifier, msgs []Message, d DeliveryConf) ([]Message, error) {
+	retries := intOf(DefaultDeliveryRetries, d.Retries)
+	backoff := d.Backoff
+	for attempt := 1; ; attempt++ {
+		err := notify(ctx, n, msgs)
+		if err == nil {
+			return nil, nil
+		}
+		msgs = undelivered(err, msgs)
+		retry, rateLimited := retryable(err)
+		if !retry || attempt > retries {
+			return msgs, err
+		}
+		wait := backoff
+		if rateLimited && wait < rateLimitBackoff {
+			wait = rateLimitBackoff
+		}
+		log.Warnf("Notify %s attempt %d/%d failed: %v, retry in %v", n.Name(), attempt, retries+1, err, wait)
+		if !sleep(ctx, wait) {
+			return msgs, err
+		}
+		backoff *= 2
+		if backoff > maxDeliveryBackoff {
+			backoff = maxDeliveryBackoff
+		}
+	}
+}
+
+//滑动窗口限流：window内最多发送limit条
+type rateLimiter struct {
+	lock   sync.Mutex
+	limit  int
+	window time.Duration
+	sent   []time.Time
+}
+
+//等待直到可以发送，ctx提前结束时返回错误
+func (l *rateLimiter) wait(ctx context.Context) error {
+	for {
+		l.lock.Lock()
+		now := time.Now()
+		for len(l.sent) > 0 && now.Sub(l.sent[0]) >= l.window {
+			l.sent = l.sent[1:]
+		}
+		if len(l.sent) < l.limit {
+			l.sent = append(l.sent, now)
+			l.lock.Unlock()
+			return nil
+		}
+		d := l.sent[0].Add(l.window).Sub(now)
+		l.lock.Unlock()
+		log.Warnf("Rate limit %d per %v reached, wait %v", l.limit, l.window, d)
+		if !sleep(ctx, d) {
+			return ctx.Err()
+		}
+	}
+}
+
+var (
+	rateLimitersLock sync.Mutex
+	rateLimiters     = map[string]*rateLimiter{}
+)
+
+//按key（如机器人token）共享的限流器，同一机器人的多个渠道共用额度
+func limiterOf(key string, limit int, window time.Duration) *rateLimiter {
+	rateLimitersLock.Lock()
+	defer rateLimitersLock.Unlock()
+	l, ok := rateLimiters[key]
+	if !ok {
+		l = &rateLimiter{limit: limit, window: window}
+		rateLimiters[key] = l
+	}
+	return l
+}
@@ -0,0 +1,274 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRetryable(t *testing.T) {
+	cases := []struct {
+		err         error
+		retry, rate bool
+	}{
+		{errors.New("unknown"), true, false},
+		{&DeliveryError{Err: errors.New("timeout"), Temporary: true}, true, false},
+		{&DeliveryError{Err: errors.New("429"), RateLimited: true}, true, true},
+		{&DeliveryError{Err: errors.New("token invalid")}, false, false},
+	}
+	for _, c := range cases {
+		if retry, rate := retryable(c.err); retry != c.retry || rate != c.rate {
+			t.Errorf("retryable(%v) = %v, %v, want %v, %v", c.err, retry, rate, c.retry, c.rate)
+		}
+	}
+}
+
+func TestHttpDo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		code, _ := strconv.Atoi(strings.TrimPrefix(req.URL.Path, "/"))
+		w.WriteHeader(code)
+	}))
+	defer server.Close()
+	cases := []struct {
+		code        int
+		ok          bool
+		retry, rate bool
+	}{
+		{200, true, false, false},
+		{500, false, true, false},
+		{503, false, true, false},
+		{429, false, true, true},
+		{400, false, false, false},
+		{404, false, false, false},
+	}
+	client := NotifierConf{}.client()
+	for _, c := range cases {
+		_, err := httpPost(client, server.URL+"/"+strconv.Itoa(c.code), "application/json", "{}")
+		if (err == nil) != c.ok {
+			t.Errorf("status %d: err = %v", c.code, err)
+			continue
+		}
+		if err == nil {
+			continue
+		}
+		if retry, rate := retryable(err); retry != c.retry || rate != c.rate {
+			t.Errorf("status %d: retryable = %v, %v, want %v, %v", c.code, retry, rate, c.retry, c.rate)
+		}
+	}
+	//连接失败可重试
+	server.Close()
+	if _, err := httpPost(client, server.URL, "application/json", "{}"); err == nil {
+		t.Error("closed server should fail")
+	} else if retry, _ := retryable(err); !retry {
+		t.Errorf("network error should be retryable: %v", err)
+	}
+}
+
+//按预设的错误依次失败的渠道，记录每次收到的消息
+type flakyNotifier struct {
+	lock  sync.Mutex
+	name  string
+	errs  []error
+	calls [][]Message
+}
+
+func (n *flakyNotifier) Name() string { return n.name }
+func (n *flakyNotifier) Notify(msgs []Message) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.calls = append(n.calls, msgs)
+	if len(n.errs) == 0 {
+		return nil
+	}
+	err := n.errs[0]
+	n.errs = n.errs[1:]
+	return err
+}
+
+func titledMsgs(titles ...string) []Message {
+	var msgs []Message
+	for _, title := range titles {
+		msgs = append(msgs, Message{Title: title, Content: title})
+	}
+	return msgs
+}
+
+func TestDeliver(t *testing.T) {
+	retries := 2
+	d := DeliveryConf{Retries: &retries, Backoff: time.Millisecond}
+	temporary := &DeliveryError{Err: errors.New("503"), Temporary: true}
+
+	//临时错误重试后成功
+	n := &flakyNotifier{errs: []error{temporary, temporary}}
+	if rest, err := deliver(context.Background(), n, titledMsgs("a"), d); err != nil || rest != nil || len(n.calls) != 3 {
+		t.Errorf("rest = %v, err = %v, calls = %d", rest, err, len(n.calls))
+	}
+
+	//超过重试次数
+	n = &flakyNotifier{errs: []error{temporary, temporary, temporary}}
+	if rest, err := deliver(context.Background(), n, titledMsgs("a"), d); err == nil || len(rest) != 1 || len(n.calls) != 3 {
+		t.Errorf("rest = %v, err = %v, calls = %d", rest, err, len(n.calls))
+	}
+
+	//不可重试的错误不重试
+	n = &flakyNotifier{errs: []error{&DeliveryError{Err: errors.New("token invalid")}}}
+	if rest, err := deliver(context.Background(), n, titledMsgs("a", "b"), d); err == nil || len(rest) != 2 || len(n.calls) != 1 {
+		t.Errorf("rest = %v, err = %v, calls = %d", rest, err, len(n.calls))
+	}
+
+	//部分送达后重试只发送剩余消息
+	n = &flakyNotifier{errs: []error{&DeliveryError{Err: errors.New("503"), Temporary: true, Rest: titledMsgs("c")}}}
+	if rest, err := deliver(context.Background(), n, titledMsgs("a", "b", "c"), d); err != nil || rest != nil {
+		t.Fatalf("rest = %v, err = %v", rest, err)
+	}
+	if len(n.calls) != 2 || len(n.calls[1]) != 1 || n.calls[1][0].Title != "c" {
+		t.Errorf("calls = %v", n.calls)
+	}
+
+	//未配置时按默认次数重试，配置为0时不重试
+	n = &flakyNotifier{errs: []error{temporary, temporary, temporary, temporary}}
+	if _, err := deliver(context.Background(), n, titledMsgs("a"), DeliveryConf{Backoff: time.Millisecond}); err == nil || len(n.calls) != DefaultDeliveryRetries+1 {
+		t.Errorf("default retries: err = %v, calls = %d", err, len(n.calls))
+	}
+	retries = 0
+	n = &flakyNotifier{errs: []error{temporary}}
+	if _, err := deliver(context.Background(), n, titledMsgs("a"), d); err == nil || len(n.calls) != 1 {
+		t.Errorf("no retries: err = %v, calls = %d", err, len(n.calls))
+	}
+}
+
+func TestOutboxReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	outbox := NewOutbox(dir, time.Hour)
+	for _, spool := range []struct {
+		notifier string
+		msgs     []Message
+	}{
+		{"a", titledMsgs("a1", "a2")},
+		{"b", titledMsgs("b1")},
+		{"a", titledMsgs("a3")},
+	} {
+		if err := outbox.Spool(spool.notifier, spool.msgs); err != nil {
+			t.Fatal(err)
+		}
+		//文件名按纳秒排序，保证先后顺序
+		time.Sleep(time.Millisecond)
+	}
+	d := DeliveryConf{Retries: new(int), Backoff: time.Millisecond}
+
+	//a部分送达后失败：只保留未送达的a2，后续的a3不发送以保证顺序；b正常重发
+	a := &flakyNotifier{name: "a", errs: []error{&DeliveryError{Err: errors.New("invalid"), Rest: titledMsgs("a2")}}}
+	b := &flakyNotifier{name: "b"}
+	outbox.Replay(context.Background(), []Notifier{a, b}, d)
+	if len(a.calls) != 1 || len(b.calls) != 1 || b.calls[0][0].Title != "b1" {
+		t.Fatalf("a calls = %v, b calls = %v", a.calls, b.calls)
+	}
+	if !outbox.Pending("a") || outbox.Pending("b") {
+		t.Errorf("pending a = %v, b = %v", outbox.Pending("a"), outbox.Pending("b"))
+	}
+
+	//a恢复后按原顺序重发剩余消息
+	outbox.Replay(context.Background(), []Notifier{a, b}, d)
+	var titles []string
+	for _, msgs := range a.calls[1:] {
+		for _, msg := range msgs {
+			titles = append(titles, msg.Title)
+		}
+	}
+	if strings.Join(titles, ",") != "a2,a3" || outbox.Pending("a") {
+		t.Errorf("replayed = %v, pending = %v", titles, outbox.Pending("a"))
+	}
+
+	//过期的暂存消息丢弃
+	outbox.Spool("a", titledMsgs("old"))
+	NewOutbox(dir, -time.Second).Replay(context.Background(), []Notifier{a}, d)
+	if outbox.Pending("a") {
+		t.Error("expired entry should be dropped")
+	}
+}
+
+//发送较慢的渠道，使并发发送发生重叠
+type slowNotifier struct {
+	recordNotifier
+}
+
+func (n *slowNotifier) Notify(msgs []Message) error {
+	time.Sleep(5 * time.Millisecond)
+	return n.recordNotifier.Notify(msgs)
+}
+
+func TestSendSerialized(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	n := &slowNotifier{}
+	m := newAckMonitor(&fakeChecker{name: "Redis"}, n)
+	m.Conf.Delivery = DeliveryConf{Outbox: dir}
+	outbox := NewOutbox(dir, time.Hour)
+	for i := 0; i < 6; i++ {
+		outbox.Spool("record", titledMsgs("spooled"+strconv.Itoa(i)))
+	}
+	//并发发送时暂存的消息只重发一次
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m.send(context.Background(), titledMsgs("new"+strconv.Itoa(i)))
+		}(i)
+	}
+	wg.Wait()
+	msgs := n.drain()
+	if len(msgs) != 10 {
+		t.Fatalf("delivered %d messages, want 10", len(msgs))
+	}
+	for i := 0; i < 6; i++ {
+		if msgs[i].Title != "spooled"+strconv.Itoa(i) {
+			t.Errorf("message %d = %s, want spooled messages first in order", i, msgs[i].Title)
+		}
+	}
+}
+
+//退出时不再等待重试，未送达的消息写入暂存目录
+func TestSendCanceled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	temporary := &DeliveryError{Err: errors.New("503"), Temporary: true}
+	n := &flakyNotifier{name: "record", errs: []error{temporary, temporary}}
+	m := newAckMonitor(&fakeChecker{name: "Redis"}, n)
+	m.Conf.Delivery = DeliveryConf{Backoff: time.Minute, Outbox: dir}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	m.send(ctx, titledMsgs("a"))
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("send took %v after cancel", d)
+	}
+	if len(n.calls) != 1 || !NewOutbox(dir, time.Hour).Pending("record") {
+		t.Errorf("calls = %d, pending = %v", len(n.calls), NewOutbox(dir, time.Hour).Pending("record"))
+	}
+
+	//已结束的ctx下只尝试一次，仍失败时暂存
+	m.send(ctx, titledMsgs("b"))
+	if len(n.calls) != 2 {
+		t.Errorf("calls = %d, want 2", len(n.calls))
+	}
+}
@@ -0,0 +1,225 @@
+// depend
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+//实例依赖关系，键为 类型/名称
+type dependencies struct {
+	//实例 -> 依赖的上游实例
+	parents map[string][]string
+	//实例 -> 依赖它的下游实例
+	children map[string][]string
+}
+
+//根据各实例的depends_on建立依赖关系，返回无法解析的引用及循环依赖
+func newDependencies(checkers []Checker) (dependencies, []error) {
+	deps := dependencies{parents: map[string][]string{}, children: map[string][]string{}}
+	var errs []error
+	keys := map[string]bool{}
+	byName := map[string][]string{}
+	for _, c := range checkers {
+		key := stateKey(c.Type(), c.Name())
+		keys[key] = true
+		byName[c.Name()] = append(byName[c.Name()], key)
+	}
+	for _, c := range checkers {
+		ai, ok := c.(AlertInfoer)
+		if !ok {
+			continue
+		}
+		key := stateKey(c.Type(), c.Name())
+		for _, dep := range ai.AlertInfo().DependsOn {
+			parent := dep
+			if !strings.Contains(dep, "/") {
+				switch len(byName[dep]) {
+				case 0:
+					parent = ""
+				case 1:
+					parent = byName[dep][0]
+				default:
+					errs = append(errs, fmt.Errorf("%s: depends_on %q is ambiguous, use type/name", key, dep))
+					continue
+				}
+			}
+			if !keys[parent] {
+				errs = append(errs, fmt.Errorf("%s: depends_on unknown instance %q", key, dep))
+				continue
+			}
+			if parent == key {
+				errs = append(errs, fmt.Errorf("%s: depends_on itself", key))
+				continue
+			}
+			deps.parents[key] = append(deps.parents[key], parent)
+			deps.children[parent] = append(deps.children[parent], key)
+		}
+	}
+	for _, c := range checkers {
+		if key := stateKey(c.Type(), c.Name()); deps.reaches(key, key, map[string]bool{}) {
+			errs = append(errs, fmt.Errorf("%s: circular depends_on", key))
+		}
+	}
+	return deps, errs
+}
+
+//从from的上游能否到达to
+func (d dependencies) reaches(from string, to string, seen map[string]bool) bool {
+	for _, parent := range d.parents[from] {
+		if parent == to {
+			return true
+		}
+		if !seen[parent] {
+			seen[parent] = true
+			if d.reaches(parent, to, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//实例的依赖深度：没有上游为0，否则为上游最大深度加1
+func (d dependencies) depth(key string, seen map[string]bool) int {
+	if seen[key] {
+		return 0
+	}
+	seen[key] = true
+	max := 0
+	for _, parent := range d.parents[key] {
+		if n := d.depth(parent, seen) + 1; n > max {
+			max = n
+		}
+	}
+	delete(seen, key)
+	return max
+}
+
+//按依赖深度分层，上游先于下游检查，返回各层在checkers中的下标
+func (d dependencies) levels(checkers []Checker) [][]int {
+	var levels [][]int
+	for i, c := range checkers {
+		n := d.depth(stateKey(c.Type(), c.Name()), map[string]bool{})
+		for len(levels) <= n {
+			levels = append(levels, nil)
+		}
+		levels[n] = append(levels[n], i)
+	}
+	//去掉因上游未参与本次检查而产生的空层
+	var out [][]int
+	for _, level := range levels {
+		if len(level) > 0 {
+			out = append(out, level)
+		}
+	}
+	return out
+}
+
+//实例是否故障：优先使用本进程最近的结果，否则使用保存的状态
+func (m *Monitor) isDown(key string) (Result, bool) {
+	m.latestLock.Lock()
+	r, ok := m.latest[key]
+	m.latestLock.Unlock()
+	if ok {
+		return r, !r.OK()
+	}
+	typ, name := splitKey(key)
+	s, ok := m.tracker.State(typ, name)
+	if !ok || (s.State != StateFailing && (s.LastCheck.IsZero() || s.LastStatus == StatusOK)) {
+		return Result{}, false
+	}
+	if c, err := m.findChecker(key); err == nil {
+		return m.resultOf(c, s), true
+	}
+	return Result{Name: name, Type: typ, Status: s.LastStatus, Time: s.LastCheck, Info: AlertInfo{}.withDefaults()}, true
+}
+
+//故障的上游实例，沿依赖向上取最上层的故障实例，都正常时返回nil
+func (m *Monitor) downParent(key string) *Result {
+	var down *Result
+	seen := map[string]bool{key: true}
+	for {
+		var next *Result
+		for _, parent := range m.deps.parents[key] {
+			if seen[parent] {
+				continue
+			}
+			if r, ok := m.isDown(parent); ok {
+				next = &r
+				key = parent
+				break
+			}
+		}
+		if next == nil {
+			return down
+		}
+		seen[key] = true
+		down = next
+	}
+}
+
+//上游故障后立即检查此后尚未检查过的下游实例，使其与上游故障在同一批消息中合并发送
+func (m *Monitor) checkChildren(ctx context.Context, c Checker) {
+	s, ok := m.tracker.State(c.Type(), c.Name())
+	if !ok || s.State != StateFailing {
+		return
+	}
+	var wg sync.WaitGroup
+	for _, key := range m.deps.children[stateKey(c.Type(), c.Name())] {
+		child, err := m.findChecker(key)
+		if err != nil {
+			//下游实例未参与本次检查，如check命令只检查部分类型
+			continue
+		}
+		m.latestLock.Lock()
+		last, checked := m.latest[key]
+		m.latestLock.Unlock()
+		if checked && !last.Time.Before(s.FirstFailure) {
+			continue
+		}
+		wg.Add(1)
+		go func(child Checker) {
+			defer wg.Done()
+			if r := m.Check(ctx, child); !r.OK() {
+				m.checkChildren(ctx, child)
+			}
+		}(child)
+	}
+	wg.Wait()
+}
+
+//将因上游故障不可达的实例的消息按上游合并为一条
+func groupUnreachable(t *Templates, msgs []Message) []Message {
+	var out []Message
+	groups := map[string]int{}
+	for _, msg := range msgs {
+		parent := msg.Event.Parent
+		if parent == nil {
+			out = append(out, msg)
+			continue
+		}
+		key := stateKey(parent.Type, parent.Name)
+		child := t.instanceText(msg.Event.Result.Name, msg.Event.Result)
+		if i, ok := groups[key]; ok {
+			out[i].Event.Children = append(out[i].Event.Children, child)
+			out[i].Content = t.content(out[i].Event)
+			continue
+		}
+		e := Event{Kind: EventUnreachable, Result: *parent, Children: []string{child}}
+		groups[key] = len(out)
+		out = append(out, t.message(e))
+	}
+	return out
+}
+
+//拆分状态键
+func splitKey(key string) (string, string) {
+	i := strings.Index(key, "/")
+	if i < 0 {
+		return "", key
+	}
+	return key[:i], key[i+1:]
+}
@@ -0,0 +1,122 @@
+package monitor
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+//声明了依赖的检查器
+type dependChecker struct {
+	fakeChecker
+	dependsOn []string
+}
+
+func (c *dependChecker) AlertInfo() AlertInfo {
+	return AlertInfo{DependsOn: c.dependsOn}
+}
+
+func TestDependencies(t *testing.T) {
+	host := &dependChecker{fakeChecker: fakeChecker{name: "Host"}}
+	nginx := &dependChecker{fakeChecker: fakeChecker{name: "Nginx"}, dependsOn: []string{"Host"}}
+	redis := &dependChecker{fakeChecker: fakeChecker{name: "Redis"}, dependsOn: []string{"fake/Host"}}
+	app := &dependChecker{fakeChecker: fakeChecker{name: "App"}, dependsOn: []string{"Nginx", "Redis"}}
+	checkers := []Checker{app, redis, nginx, host}
+	deps, errs := newDependencies(checkers)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if got := deps.children["fake/Host"]; len(got) != 2 {
+		t.Errorf("children of Host = %v", got)
+	}
+	//Host先检查，App最后
+	levels := deps.levels(checkers)
+	if len(levels) != 3 || len(levels[0]) != 1 || levels[0][0] != 3 || len(levels[2]) != 1 || levels[2][0] != 0 {
+		t.Errorf("levels = %v", levels)
+	}
+
+	host.dependsOn = []string{"App"}
+	bad := &dependChecker{fakeChecker: fakeChecker{name: "Bad"}, dependsOn: []string{"Nope", "Bad"}}
+	_, errs = newDependencies(append(checkers, bad))
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	text := strings.Join(msgs, "\n")
+	for _, want := range []string{`unknown instance "Nope"`, "fake/Bad: depends_on itself", "fake/Host: circular depends_on"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("errors %q missing %q", text, want)
+		}
+	}
+}
+
+func TestDependUnreachable(t *testing.T) {
+	host := &dependChecker{fakeChecker: fakeChecker{name: "Host", status: StatusOK}}
+	nginx := &dependChecker{fakeChecker: fakeChecker{name: "Nginx", status: StatusOK}, dependsOn: []string{"Host"}}
+	redis := &dependChecker{fakeChecker: fakeChecker{name: "Redis", status: StatusOK}, dependsOn: []string{"Host"}}
+	n := &recordNotifier{}
+	m := newAckMonitor(host, n)
+	m.Checkers = []Checker{redis, nginx, host}
+	m.slots = make(chan struct{}, 3)
+	m.deps, _ = newDependencies(m.Checkers)
+	ctx := context.Background()
+	m.RunOnce(ctx)
+	n.drain()
+
+	//主机故障：主机单独告警，下游合并为一条
+	host.status, nginx.status, redis.status = StatusFailed, StatusFailed, StatusFailed
+	m.RunOnce(ctx)
+	msgs := n.drain()
+	if len(msgs) != 2 {
+		t.Fatalf("messages = %+v", msgs)
+	}
+	if msgs[0].Event.Kind != EventFailing || msgs[0].Event.Result.Name != "Host" {
+		t.Errorf("first message = %+v", msgs[0])
+	}
+	group := msgs[1]
+	if group.Event.Kind != EventUnreachable || group.Event.Result.Name != "Host" || len(group.Event.Children) != 2 {
+		t.Fatalf("group message = %+v", group)
+	}
+	if !strings.Contains(group.Content, "Redis（FAKE）") || !strings.Contains(group.Content, "Nginx（FAKE）") {
+		t.Errorf("group content = %q", group.Content)
+	}
+
+	//主机恢复后Redis仍故障时补发，Nginx恢复时正常通知
+	host.status, nginx.status = StatusOK, StatusOK
+	m.RunOnce(ctx)
+	kinds := map[string]EventKind{}
+	for _, msg := range n.drain() {
+		kinds[msg.Event.Result.Name] = msg.Event.Kind
+	}
+	if len(kinds) != 3 || kinds["Host"] != EventRecovered || kinds["Nginx"] != EventRecovered || kinds["Redis"] != EventRepeat {
+		t.Errorf("events after host recovered = %v", kinds)
+	}
+}
+
+func TestCheckChildren(t *testing.T) {
+	host := &dependChecker{fakeChecker: fakeChecker{name: "Host", status: StatusOK}}
+	nginx := &dependChecker{fakeChecker: fakeChecker{name: "Nginx", status: StatusOK}, dependsOn: []string{"Host"}}
+	n := &recordNotifier{}
+	m := newAckMonitor(host, n)
+	m.Checkers = []Checker{host, nginx}
+	m.slots = make(chan struct{}, 2)
+	m.deps, _ = newDependencies(m.Checkers)
+	ctx := context.Background()
+	m.RunOnce(ctx)
+	n.drain()
+
+	host.status, nginx.status = StatusFailed, StatusFailed
+	m.Check(ctx, host)
+	m.checkChildren(ctx, host)
+	m.Flush()
+	if msgs := n.drain(); len(msgs) != 2 || msgs[1].Event.Kind != EventUnreachable {
+		t.Fatalf("messages = %+v", msgs)
+	}
+	//本次故障中已检查过的下游不再立即检查
+	m.Check(ctx, host)
+	m.checkChildren(ctx, host)
+	m.Flush()
+	if msgs := n.drain(); len(msgs) != 0 {
+		t.Errorf("messages = %+v", msgs)
+	}
+}
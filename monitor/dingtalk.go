@@ -0,0 +1,304 @@
+// dingtalk
+package monitor
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var dingdingBaseServer = "https://oapi.dingtalk.com/robot/send"
+
+const (
+	//单条消息默认最大字节数，钉钉限制为20000字节
+	DefaultDingTalkMaxBytes = 18000
+	//单次通知默认最多拆分的消息条数，超出部分汇总为“还有N个故障未展示”
+	DefaultDingTalkMaxMessages = 5
+	//每个机器人每分钟默认最多发送条数
+	DefaultDingTalkRateLimit = 20
+)
+
+func init() {
+	RegisterNotifier("dingtalk", func(nc NotifierConf) (Notifier, error) {
+		n := &DingTalkNotifier{name: nc.Name, client: nc.client(), templates: nc.Templates}
+		if err := nc.Decode(n); err != nil {
+			return nil, err
+		}
+		if n.Token == "" {
+			return nil, fmt.Errorf("token is empty")
+		}
+		switch n.Msgtype {
+		case "", "text", "markdown", "actionCard":
+		default:
+			return nil, fmt.Errorf("unknown msgtype %q", n.Msgtype)
+		}
+		return n, nil
+	})
+}
+
+//钉钉自定义机器人
+type DingTalkNotifier struct {
+	name string
+	//发送请求使用的客户端，超时由delivery.timeout配置
+	client *http.Client
+	//消息文字使用的模板
+	templates *Templates
+	Token     string `yaml:"token"`
+	//加签密钥，机器人安全设置为“加签”时配置
+	Secret string `yaml:"secret"`
+	//自定义关键词，机器人安全设置为“自定义关键词”时配置，会加在消息开头
+	Keyword string `yaml:"keyword"`
+	//机器人接口地址，默认为钉钉官方地址
+	Url string `yaml:"url"`
+	//消息类型：text（默认）、markdown、actionCard
+	Msgtype string `yaml:"msgtype"`
+	//按告警级别@的人，键为critical、warning、info、recovered
+	At map[string]DingTalkAt `yaml:"at"`
+	//单条消息最大字节数、单次通知最多拆分条数及每分钟最多发送条数
+	MaxBytes    int `yaml:"max_bytes"`
+	MaxMessages int `yaml:"max_messages"`
+	RateLimit   int `yaml:"rate_limit"`
+	//当前时间，用于计算签名
+	now func() time.Time
+}
+
+//钉钉@设置
+type DingTalkAt struct {
+	AtMobiles []string `yaml:"at_mobiles" json:"atMobiles,omitempty"`
+	IsAtAll   bool     `yaml:"at_all" json:"isAtAll,omitempty"`
+}
+
+//钉钉ActionCard按钮
+type dingTalkBtn struct {
+	Title     string `json:"title"`
+	ActionURL string `json:"actionURL"`
+}
+
+func (n *DingTalkNotifier) Name() string { return n.name }
+
+//发送消息，限流等待不可取消，见NotifyContext
+func (n *DingTalkNotifier) Notify(msgs []Message) error {
+	return n.NotifyContext(context.Background(), msgs)
+}
+
+//发送消息到钉钉：按级别排序后拆分为不超过大小限制的多条消息，按机器人限流依次发送
+func (n *DingTalkNotifier) NotifyContext(ctx context.Context, msgs []Message) error {
+	limiter := limiterOf("dingtalk/"+n.Token, positive(n.RateLimit, DefaultDingTalkRateLimit), time.Minute)
+	return sendChunks(ctx, n.split(sortBySeverity(msgs)), limiter, func(c msgChunk) error {
+		return n.send(n.chunkPayload(c))
+	})
+}
+
+//发送一条消息
+func (n *DingTalkNotifier) send(payload map[string]interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	body, err := httpPost(n.client, n.webhook(), "application/json", string(data))
+	if err != nil {
+		return err
+	}
+	return dingTalkError(body)
+}
+
+//按max_bytes拆分消息，超过max_messages条时其余消息汇总到最后一条
+func (n *DingTalkNotifier) split(msgs []Message) []msgChunk {
+	return splitChunks(n.templates, msgs, positive(n.MaxBytes, DefaultDingTalkMaxBytes), positive(n.MaxMessages, DefaultDingTalkMaxMessages), n.size)
+}
+
+//消息体的字节数
+func (n *DingTalkNotifier) size(c msgChunk) int {
+	data, _ := json.Marshal(n.chunkPayload(c))
+	return len(data)
+}
+
+//解析钉钉返回的errcode，0为成功
+func dingTalkError(body []byte) error {
+	var resp struct {
+		Errcode int    `json:"errcode"`
+		Errmsg  string `json:"errmsg"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return &DeliveryError{Err: fmt.Errorf("invalid dingtalk response %q: %v", body, err), Temporary: true}
+	}
+	switch resp.Errcode {
+	case 0:
+		return nil
+	case 130101:
+		//发送太快，每个机器人每分钟最多20条
+		return &DeliveryError{Err: fmt.Errorf("dingtalk rate limited: %s", resp.Errmsg), RateLimited: true}
+	case -1:
+		//系统繁忙
+		return &DeliveryError{Err: fmt.Errorf("dingtalk busy: %s", resp.Errmsg), Temporary: true}
+	default:
+		return &DeliveryError{Err: fmt.Errorf("dingtalk error %d: %s", resp.Errcode, resp.Errmsg)}
+	}
+}
+
+//按msgtype生成消息体
+func (n *DingTalkNotifier) payload(msgs []Message) map[string]interface{} {
+	return n.chunkPayload(msgChunk{msgs: msgs})
+}
+
+func (n *DingTalkNotifier) chunkPayload(c msgChunk) map[string]interface{} {
+	//未展示的故障同样需要@相关的人
+	at := n.at(append(c.msgs[:len(c.msgs):len(c.msgs)], c.overflow...))
+	switch n.Msgtype {
+	case "markdown":
+		return n.markdownPayload(c, at)
+	case "actionCard":
+		btns := n.btns(c.msgs)
+		//没有处理手册链接时退化为markdown
+		if len(btns) == 0 {
+			return n.markdownPayload(c, at)
+		}
+		card := map[string]interface{}{
+			"title":          n.title(c),
+			"text":           n.markdown(c, DingTalkAt{}),
+			"btnOrientation": "0",
+		}
+		if len(btns) == 1 {
+			card["singleTitle"] = btns[0].Title
+			card["singleURL"] = btns[0].ActionURL
+		} else {
+			card["btns"] = btns
+		}
+		return map[string]interface{}{"msgtype": "actionCard", "actionCard": card}
+	default:
+		var content = ""
+		if n.Keyword != "" {
+			content = n.Keyword + "\n"
+		}
+		if c.part != "" {
+			content += n.templates.batchTitle(c) + "\n"
+		}
+		for _, msg := range c.msgs {
+			content += msg.Title + "\n" + msg.Content + "\n"
+		}
+		if len(c.overflow) > 0 {
+			content += n.templates.overflowText(c.overflow) + "\n"
+		}
+		return map[string]interface{}{
+			"msgtype": "text",
+			"text":    map[string]string{"content": content},
+			"at":      at,
+		}
+	}
+}
+
+func (n *DingTalkNotifier) markdownPayload(c msgChunk, at DingTalkAt) map[string]interface{} {
+	return map[string]interface{}{
+		"msgtype":  "markdown",
+		"markdown": map[string]string{"title": n.title(c), "text": n.markdown(c, at)},
+		"at":       at,
+	}
+}
+
+//消息标题，如“服务监控：严重2 已恢复1”，拆分时带序号
+func (n *DingTalkNotifier) title(c msgChunk) string {
+	return n.Keyword + n.templates.batchTitle(c)
+}
+
+//markdown正文：每个级别一个标题，下面逐行列出实例、目标及错误，见line.dingtalk模板
+func (n *DingTalkNotifier) markdown(c msgChunk, at DingTalkAt) string {
+	var b strings.Builder
+	if n.Keyword != "" {
+		b.WriteString(n.Keyword + "\n\n")
+	}
+	for _, g := range GroupBySeverity(c.msgs) {
+		fmt.Fprintf(&b, "### <font color=%s>%s</font>\n\n", severityColors[g.Severity], n.templates.groupTitle(g))
+		for _, msg := range g.Msgs {
+			b.WriteString(n.templates.lineText("line.dingtalk", msg, true) + "\n")
+		}
+		b.WriteString("\n")
+	}
+	if len(c.overflow) > 0 {
+		b.WriteString("> " + n.templates.overflowText(c.overflow) + "\n\n")
+	}
+	//markdown消息需要在正文中包含@手机号才会提醒
+	for _, mobile := range at.AtMobiles {
+		b.WriteString("@" + mobile + " ")
+	}
+	return strings.TrimRight(b.String(), " \n")
+}
+
+//汇总本批消息需要@的人：实例配置的at_mobiles/at_all（恢复消息除外）及渠道按级别配置的at
+func (n *DingTalkNotifier) at(msgs []Message) DingTalkAt {
+	var at DingTalkAt
+	seen := map[string]bool{}
+	add := func(mobiles []string, all bool) {
+		for _, mobile := range mobiles {
+			if !seen[mobile] {
+				seen[mobile] = true
+				at.AtMobiles = append(at.AtMobiles, mobile)
+			}
+		}
+		at.IsAtAll = at.IsAtAll || all
+	}
+	for _, msg := range msgs {
+		severity := msg.Severity()
+		if severity != "recovered" {
+			add(msg.Event.Result.Info.AtMobiles, msg.Event.Result.Info.AtAll)
+		}
+		if a, ok := n.At[severity]; ok {
+			add(a.AtMobiles, a.IsAtAll)
+		}
+	}
+	return at
+}
+
+//ActionCard按钮：每个配置了处理手册的实例一个，及每个带确认链接的故障一个
+func (n *DingTalkNotifier) btns(msgs []Message) []dingTalkBtn {
+	var btns []dingTalkBtn
+	seen := map[string]bool{}
+	for _, msg := range msgs {
+		r := msg.Event.Result
+		if r.Info.Runbook == "" || seen[r.Info.Runbook] {
+			continue
+		}
+		seen[r.Info.Runbook] = true
+		btns = append(btns, dingTalkBtn{Title: r.Name + " " + n.templates.labelText("runbook"), ActionURL: r.Info.Runbook})
+	}
+	for _, msg := range msgs {
+		if msg.AckURL != "" {
+			btns = append(btns, dingTalkBtn{Title: msg.Event.Result.Name + " " + n.templates.labelText("ack"), ActionURL: msg.AckURL})
+		}
+	}
+	return btns
+}
+
+//机器人地址，配置了secret时附加timestamp及sign
+func (n *DingTalkNotifier) webhook() string {
+	base := n.Url
+	if base == "" {
+		base = dingdingBaseServer
+	}
+	query := url.Values{}
+	query.Set("access_token", n.Token)
+	if n.Secret != "" {
+		now := time.Now
+		if n.now != nil {
+			now = n.now
+		}
+		timestamp := strconv.FormatInt(now().UnixNano()/int64(time.Millisecond), 10)
+		query.Set("timestamp", timestamp)
+		query.Set("sign", dingTalkSign(timestamp, n.Secret))
+	}
+	return base + "?" + query.Encode()
+}
+
+//钉钉加签：base64(HmacSHA256(secret, timestamp+"\n"+secret))
+func dingTalkSign(timestamp string, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,313 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+//本地模拟的钉钉机器人接口，按钉钉规则校验token、签名及关键词
+type fakeDingTalk struct {
+	token   string
+	secret  string
+	keyword string
+	now     time.Time
+	//接受limit条后按发送太快拒绝，0为不限
+	limit int
+	//收到的消息内容、请求大小及拒绝原因
+	contents []string
+	sizes    []int64
+	rejected []string
+}
+
+func (f *fakeDingTalk) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	reply := func(code int, msg string) {
+		if code != 0 {
+			f.rejected = append(f.rejected, msg)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"errcode": code, "errmsg": msg})
+	}
+	if query.Get("access_token") != f.token {
+		reply(300001, "token is not exist")
+		return
+	}
+	if f.secret != "" {
+		ts, err := strconv.ParseInt(query.Get("timestamp"), 10, 64)
+		if err != nil {
+			reply(310000, "invalid timestamp")
+			return
+		}
+		//钉钉要求timestamp与服务器时间相差不超过1小时
+		if d := f.now.Sub(time.Unix(0, ts*int64(time.Millisecond))); d > time.Hour || d < -time.Hour {
+			reply(310000, "timestamp expired")
+			return
+		}
+		if query.Get("sign") != dingTalkSign(query.Get("timestamp"), f.secret) {
+			reply(310000, "sign not match")
+			return
+		}
+	} else if query.Get("sign") != "" || query.Get("timestamp") != "" {
+		reply(310000, "unexpected sign params")
+		return
+	}
+	var body struct {
+		Msgtype string `json:"msgtype"`
+		Text    struct {
+			Content string `json:"content"`
+		} `json:"text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		reply(400, "invalid json: "+err.Error())
+		return
+	}
+	if f.keyword != "" && !strings.Contains(body.Text.Content, f.keyword) {
+		reply(310000, "keywords not in content")
+		return
+	}
+	if f.limit > 0 && len(f.contents) >= f.limit {
+		reply(130101, "send too fast")
+		return
+	}
+	f.contents = append(f.contents, body.Text.Content)
+	f.sizes = append(f.sizes, r.ContentLength)
+	reply(0, "ok")
+}
+
+func newTestDingTalk(t *testing.T, fake *fakeDingTalk, options map[string]interface{}) (*DingTalkNotifier, func()) {
+	server := httptest.NewServer(fake)
+	options["url"] = server.URL
+	n, err := NewNotifier(NotifierConf{Name: "test", Type: "dingtalk", Options: options})
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	d := n.(*DingTalkNotifier)
+	d.now = func() time.Time { return fake.now }
+	return d, server.Close
+}
+
+var testMsgs = []Message{{Title: "TCP -> ActiveMQ【192.168.10.102:61616】", Content: "连接被拒绝"}}
+
+func TestDingTalkSign(t *testing.T) {
+	//与钉钉文档中的算法独立计算的结果对照
+	got := dingTalkSign("1577000000000", "SEC1234567890abcdef")
+	want := "rY1eD+gbMiBMfYEl7S7KH2+W8/0+QLf5//XbbESZA9A="
+	if got != want {
+		t.Errorf("dingTalkSign = %s, want %s", got, want)
+	}
+}
+
+func TestDingTalkNotifySigned(t *testing.T) {
+	fake := &fakeDingTalk{token: "tk", secret: "SECabc", now: time.Now()}
+	n, stop := newTestDingTalk(t, fake, map[string]interface{}{"token": "tk", "secret": "SECabc"})
+	defer stop()
+	if err := n.Notify(testMsgs); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.rejected) != 0 || len(fake.contents) != 1 || !strings.Contains(fake.contents[0], "连接被拒绝") {
+		t.Errorf("contents = %q, rejected = %q", fake.contents, fake.rejected)
+	}
+}
+
+func TestDingTalkNotifyWrongSecret(t *testing.T) {
+	fake := &fakeDingTalk{token: "tk", secret: "SECabc", now: time.Now()}
+	n, stop := newTestDingTalk(t, fake, map[string]interface{}{"token": "tk", "secret": "SECother"})
+	defer stop()
+	n.Notify(testMsgs)
+	if len(fake.contents) != 0 || len(fake.rejected) != 1 || fake.rejected[0] != "sign not match" {
+		t.Errorf("contents = %q, rejected = %q", fake.contents, fake.rejected)
+	}
+}
+
+func TestDingTalkNotifyUnsigned(t *testing.T) {
+	fake := &fakeDingTalk{token: "tk", now: time.Now()}
+	n, stop := newTestDingTalk(t, fake, map[string]interface{}{"token": "tk"})
+	defer stop()
+	if err := n.Notify(testMsgs); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.rejected) != 0 || len(fake.contents) != 1 {
+		t.Errorf("contents = %q, rejected = %q", fake.contents, fake.rejected)
+	}
+}
+
+func TestDingTalkNotifyKeyword(t *testing.T) {
+	fake := &fakeDingTalk{token: "tk", keyword: "监控告警", now: time.Now()}
+	n, stop := newTestDingTalk(t, fake, map[string]interface{}{"token": "tk", "keyword": "监控告警"})
+	defer stop()
+	if err := n.Notify(testMsgs); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.rejected) != 0 || len(fake.contents) != 1 || !strings.HasPrefix(fake.contents[0], "监控告警\n") {
+		t.Errorf("contents = %q, rejected = %q", fake.contents, fake.rejected)
+	}
+}
+
+func TestLegacyDingTalkConf(t *testing.T) {
+	conf := &Conf{DdRobotToken: "tk", DdRobotSecret: "SECabc", DdRobotKeyword: "监控告警"}
+	ncs := conf.NotifierConfs()
+	if len(ncs) != 1 {
+		t.Fatalf("NotifierConfs() = %v", ncs)
+	}
+	n, err := NewNotifier(ncs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := n.(*DingTalkNotifier)
+	if d.Token != "tk" || d.Secret != "SECabc" || d.Keyword != "监控告警" {
+		t.Errorf("legacy notifier = %+v", d)
+	}
+}
+
+//测试用的故障及恢复消息
+func testEventMsgs() []Message {
+	down := Result{Name: "Nginx", Type: "http", Target: "http://192.168.1.100:80", Status: StatusFailed, Message: "请求异常",
+		Info: AlertInfo{Severity: SeverityCritical, Runbook: "https://wiki.example.com/nginx", AtMobiles: []string{"13800000001"}}}
+	warn := Result{Name: "Redis", Type: "redis", Target: "192.168.10.100:6379", Status: StatusTimeout, Message: "检查超时",
+		Info: AlertInfo{Severity: SeverityWarning}}
+	up := Result{Name: "MySQL", Type: "mysql", Target: "192.168.10.100:3306", Status: StatusOK,
+		Info: AlertInfo{Severity: SeverityCritical, AtMobiles: []string{"13800000002"}}}
+	return []Message{
+		NewMessage(Event{Kind: EventFailing, Result: warn}),
+		NewMessage(Event{Kind: EventRecovered, Result: up, Downtime: 12 * time.Minute}),
+		NewMessage(Event{Kind: EventFailing, Result: down}),
+	}
+}
+
+func TestDingTalkMarkdown(t *testing.T) {
+	n := &DingTalkNotifier{Msgtype: "markdown", At: map[string]DingTalkAt{SeverityWarning: {AtMobiles: []string{"13800000003"}}}}
+	payload := n.payload(testEventMsgs())
+	md := payload["markdown"].(map[string]string)
+	if md["title"] != "服务监控：严重1 警告1 已恢复1" {
+		t.Errorf("title = %q", md["title"])
+	}
+	text := md["text"]
+	critical := strings.Index(text, "严重（1）")
+	warning := strings.Index(text, "警告（1）")
+	recovered := strings.Index(text, "已恢复（1）")
+	if critical < 0 || warning < critical || recovered < warning {
+		t.Errorf("severity headings out of order:\n%s", text)
+	}
+	for _, want := range []string{"**Nginx**（HTTP）｜ `http://192.168.1.100:80` ｜ 请求异常", "[处理手册](https://wiki.example.com/nginx)", "@13800000001", "@13800000003"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("markdown missing %q:\n%s", want, text)
+		}
+	}
+	//恢复消息不@实例配置的人
+	at := payload["at"].(DingTalkAt)
+	if strings.Contains(text, "13800000002") || len(at.AtMobiles) != 2 {
+		t.Errorf("at = %+v", at)
+	}
+}
+
+func TestDingTalkActionCard(t *testing.T) {
+	n := &DingTalkNotifier{Msgtype: "actionCard"}
+	payload := n.payload(testEventMsgs())
+	card, ok := payload["actionCard"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("payload = %v", payload)
+	}
+	if card["singleURL"] != "https://wiki.example.com/nginx" || card["singleTitle"] != "Nginx 处理手册" {
+		t.Errorf("card = %v", card)
+	}
+
+	//没有处理手册时退化为markdown
+	payload = n.payload(testMsgs)
+	if payload["msgtype"] != "markdown" {
+		t.Errorf("msgtype = %v", payload["msgtype"])
+	}
+}
+
+//n个故障消息
+func testFailures(n int) []Message {
+	var msgs []Message
+	for i := 0; i < n; i++ {
+		r := Result{Name: fmt.Sprintf("svc%02d", i), Type: "tcp", Target: fmt.Sprintf("10.0.0.%d:80", i), Status: StatusFailed, Message: "连接被拒绝"}
+		msgs = append(msgs, NewMessage(Event{Kind: EventFailing, Result: r}))
+	}
+	return msgs
+}
+
+func TestDingTalkChunking(t *testing.T) {
+	fake := &fakeDingTalk{token: "chunk", now: time.Now()}
+	n, stop := newTestDingTalk(t, fake, map[string]interface{}{"token": "chunk", "max_bytes": 1000, "max_messages": 3})
+	defer stop()
+	if err := n.Notify(testFailures(100)); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.contents) != 3 {
+		t.Fatalf("sent %d messages, want 3", len(fake.contents))
+	}
+	shown := 0
+	for i, content := range fake.contents {
+		if fake.sizes[i] > 1000 {
+			t.Errorf("message %d is %d bytes", i, fake.sizes[i])
+		}
+		if !strings.Contains(content, fmt.Sprintf("（%d/3）", i+1)) {
+			t.Errorf("message %d has no part number: %q", i, content)
+		}
+		shown += strings.Count(content, "连接被拒绝")
+	}
+	//按顺序发送，超出部分汇总在最后一条
+	if !strings.Contains(fake.contents[0], "svc00") || strings.Contains(fake.contents[1], "svc00") {
+		t.Errorf("messages out of order: %q", fake.contents)
+	}
+	if more := fmt.Sprintf("还有%d个故障未展示", 100-shown); !strings.HasSuffix(strings.TrimSpace(fake.contents[2]), more) {
+		t.Errorf("last message = %q, want suffix %q", fake.contents[2], more)
+	}
+}
+
+func TestDingTalkTruncate(t *testing.T) {
+	n := &DingTalkNotifier{MaxBytes: 500}
+	msg := Message{Title: "HTTP -> Nginx", Content: strings.Repeat("错误信息", 200)}
+	chunks := n.split([]Message{msg})
+	if len(chunks) != 1 || n.size(chunks[0]) > 500 || !strings.HasSuffix(chunks[0].msgs[0].Content, "（内容过长已截断）") {
+		t.Errorf("chunks = %+v", chunks)
+	}
+}
+
+func TestDingTalkPartialDelivery(t *testing.T) {
+	fake := &fakeDingTalk{token: "partial", now: time.Now(), limit: 1}
+	n, stop := newTestDingTalk(t, fake, map[string]interface{}{"token": "partial", "max_bytes": 1000})
+	defer stop()
+	msgs := testFailures(20)
+	err := n.Notify(msgs)
+	rest := undelivered(err, msgs)
+	if retry, rateLimited := retryable(err); !retry || !rateLimited {
+		t.Errorf("err = %v, want rate limited", err)
+	}
+	//已送达的消息不在剩余消息中
+	if len(fake.contents) != 1 || len(rest) == 0 || len(rest) >= len(msgs) {
+		t.Fatalf("sent %q, rest %d", fake.contents, len(rest))
+	}
+	if !strings.Contains(fake.contents[0], "svc00【") || strings.Contains(fake.contents[0], rest[0].Event.Result.Name+"【") {
+		t.Errorf("first message = %q, rest starts with %s", fake.contents[0], rest[0].Event.Result.Name)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := &rateLimiter{limit: 2, window: 200 * time.Millisecond}
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		l.wait(context.Background())
+	}
+	if d := time.Since(start); d < 200*time.Millisecond {
+		t.Errorf("3 sends with limit 2 took %v, want >= 200ms", d)
+	}
+	//ctx结束时不再等待
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l = &rateLimiter{limit: 1, window: time.Hour}
+	l.wait(context.Background())
+	start = time.Now()
+	if err := l.wait(ctx); err == nil || time.Since(start) >= 100*time.Millisecond {
+		t.Errorf("canceled wait = %v after %v", err, time.Since(start))
+	}
+}
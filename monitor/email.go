@@ -0,0 +1,254 @@
+// email
+package monitor
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterNotifier("email", func(nc NotifierConf) (Notifier, error) {
+		n := &EmailNotifier{name: nc.Name, timeout: nc.timeout(), templates: nc.Templates}
+		if err := nc.Decode(n); err != nil {
+			return nil, err
+		}
+		if n.Host == "" {
+			return nil, fmt.Errorf("host is empty")
+		}
+		switch n.TLS {
+		case "", "starttls", "tls", "none":
+		default:
+			return nil, fmt.Errorf("unknown tls mode %q", n.TLS)
+		}
+		if _, err := mail.ParseAddress(n.From); err != nil {
+			return nil, fmt.Errorf("invalid from %q: %v", n.From, err)
+		}
+		if len(n.To)+len(n.Cc) == 0 {
+			return nil, fmt.Errorf("no recipients")
+		}
+		for _, addr := range append(n.To[:len(n.To):len(n.To)], n.Cc...) {
+			if _, err := mail.ParseAddress(addr); err != nil {
+				return nil, fmt.Errorf("invalid recipient %q: %v", addr, err)
+			}
+		}
+		return n, nil
+	})
+}
+
+//SMTP邮件
+type EmailNotifier struct {
+	name string
+	//连接及发送超时，由delivery.timeout配置
+	timeout time.Duration
+	//主题及正文使用的模板
+	templates *Templates
+	Host      string `yaml:"host"`
+	//端口，默认tls为465，其余为25
+	Port int `yaml:"port"`
+	//加密方式：默认服务器支持时使用STARTTLS；starttls要求STARTTLS；tls为直接TLS连接（465端口）；none不加密
+	TLS string `yaml:"tls"`
+	//不校验服务器证书，用于内网自签名证书
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+	//认证用户名及密码，为空时不认证
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	//发件人及收件人，如"运维 <ops@example.com>"
+	From string   `yaml:"from"`
+	To   []string `yaml:"to"`
+	Cc   []string `yaml:"cc"`
+}
+
+func (n *EmailNotifier) Name() string { return n.name }
+
+//发送邮件，SMTP 4xx及网络错误可重试，5xx不重试
+func (n *EmailNotifier) Notify(msgs []Message) error {
+	data, err := n.message(msgs, time.Now())
+	if err != nil {
+		return err
+	}
+	return smtpError(n.send(data))
+}
+
+//连接服务器并发送
+func (n *EmailNotifier) send(data []byte) error {
+	port := n.Port
+	if port == 0 {
+		port = 25
+		if n.TLS == "tls" {
+			port = 465
+		}
+	}
+	addr := net.JoinHostPort(n.Host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: n.Host, InsecureSkipVerify: n.InsecureSkipVerify}
+	dialer := &net.Dialer{Timeout: n.timeout}
+	var conn net.Conn
+	var err error
+	if n.TLS == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(n.timeout))
+	c, err := smtp.NewClient(conn, n.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if n.TLS == "" || n.TLS == "starttls" {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err = c.StartTLS(tlsConfig); err != nil {
+				return err
+			}
+		} else if n.TLS == "starttls" {
+			return &DeliveryError{Err: fmt.Errorf("smtp server %s does not support STARTTLS", addr)}
+		}
+	}
+	if n.Username != "" {
+		if err = c.Auth(smtp.PlainAuth("", n.Username, n.Password, n.Host)); err != nil {
+			return err
+		}
+	}
+	from, _ := mail.ParseAddress(n.From)
+	if err = c.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, rcpt := range append(n.To[:len(n.To):len(n.To)], n.Cc...) {
+		to, _ := mail.ParseAddress(rcpt)
+		if err = c.Rcpt(to.Address); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(data); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+//SMTP错误分类：4xx临时错误可重试，5xx不重试，其余（网络错误等）可重试
+func smtpError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var de *DeliveryError
+	if errors.As(err, &de) {
+		return err
+	}
+	var pe *textproto.Error
+	if errors.As(err, &pe) {
+		return &DeliveryError{Err: err, Temporary: pe.Code < 500}
+	}
+	return &DeliveryError{Err: err, Temporary: true}
+}
+
+//邮件中的一行结果
+type emailRow struct {
+	Severity string
+	Color    string
+	Name     string
+	Type     string
+	Target   string
+	Message  string
+	Duration string
+	Runbook  string
+}
+
+//生成邮件：主题为各级别数量，正文为email.text及email.html模板生成的纯文本及HTML表格
+func (n *EmailNotifier) message(msgs []Message, now time.Time) ([]byte, error) {
+	var rows []emailRow
+	for _, g := range GroupBySeverity(msgs) {
+		for _, msg := range g.Msgs {
+			r := msg.Event.Result
+			row := emailRow{Severity: n.templates.severityLabel(g.Severity), Color: severityColors[g.Severity], Name: r.Name, Type: TypeLabel(r.Type),
+				Target: r.Target, Message: msg.Content, Runbook: r.Info.Runbook}
+			if r.Name == "" {
+				row.Name, row.Type = msg.Title, ""
+			}
+			if r.Duration > 0 {
+				row.Duration = r.Duration.Round(time.Millisecond).String()
+			}
+			rows = append(rows, row)
+		}
+	}
+	title := n.templates.batchTitle(msgChunk{msgs: msgs})
+	hostname, _ := os.Hostname()
+	data := map[string]interface{}{"Title": title, "Rows": rows, "Hostname": hostname}
+	var text, html bytes.Buffer
+	if err := n.templates.execute(&text, "email.text", data); err != nil {
+		return nil, err
+	}
+	if err := n.templates.execute(&html, "email.html", data); err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		data        []byte
+	}{{"text/plain; charset=UTF-8", text.Bytes()}, {"text/html; charset=UTF-8", html.Bytes()}} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(w)
+		qw.Write(part.data)
+		qw.Close()
+	}
+	mw.Close()
+
+	var b bytes.Buffer
+	header := func(k, v string) { fmt.Fprintf(&b, "%s: %s\r\n", k, v) }
+	header("From", formatAddrs([]string{n.From}))
+	if len(n.To) > 0 {
+		header("To", formatAddrs(n.To))
+	}
+	if len(n.Cc) > 0 {
+		header("Cc", formatAddrs(n.Cc))
+	}
+	header("Subject", mime.BEncoding.Encode("UTF-8", title))
+	header("Date", now.Format(time.RFC1123Z))
+	header("Message-ID", fmt.Sprintf("<%d.servermonitor@%s>", now.UnixNano(), hostname))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	b.WriteString("\r\n")
+	b.Write(body.Bytes())
+	return b.Bytes(), nil
+}
+
+//邮件头中的地址列表，中文名称按RFC 2047编码
+func formatAddrs(addrs []string) string {
+	var formatted []string
+	for _, addr := range addrs {
+		if a, err := mail.ParseAddress(addr); err == nil {
+			formatted = append(formatted, a.String())
+		}
+	}
+	return strings.Join(formatted, ", ")
+}
@@ -0,0 +1,251 @@
+package monitor
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http/httptest"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+//本地模拟的SMTP服务器，支持STARTTLS及AUTH PLAIN
+type fakeSMTP struct {
+	listener net.Listener
+	//配置后支持STARTTLS
+	tls *tls.Config
+	//RCPT TO时返回的错误，如"550 no such user"
+	rcptReply string
+	//收到的认证信息、发件人、收件人及邮件内容
+	auth  string
+	from  string
+	rcpts []string
+	data  string
+	//是否已切换为TLS
+	secure bool
+	done   chan struct{}
+}
+
+//启动fakeSMTP，implicit为true时直接使用TLS连接
+func newFakeSMTP(t *testing.T, f *fakeSMTP, implicit bool) (host string, port int) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if implicit {
+		l = tls.NewListener(l, f.tls)
+	}
+	f.listener = l
+	f.done = make(chan struct{})
+	go f.serve(implicit)
+	addr := l.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func (f *fakeSMTP) serve(secure bool) {
+	defer close(f.done)
+	defer f.listener.Close()
+	conn, err := f.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	f.secure = secure
+	r := bufio.NewReader(conn)
+	reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+	reply("220 fake ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch {
+		case cmd == "EHLO":
+			reply("250-fake")
+			if f.tls != nil && !f.secure {
+				reply("250-STARTTLS")
+			}
+			reply("250 AUTH PLAIN")
+		case cmd == "STARTTLS":
+			reply("220 ready")
+			tc := tls.Server(conn, f.tls)
+			if tc.Handshake() != nil {
+				return
+			}
+			conn, r, f.secure = tc, bufio.NewReader(tc), true
+		case cmd == "AUTH":
+			f.auth = strings.TrimPrefix(line, "AUTH PLAIN ")
+			reply("235 ok")
+		case strings.HasPrefix(strings.ToUpper(line), "MAIL FROM:"):
+			f.from = line[len("MAIL FROM:"):]
+			reply("250 ok")
+		case strings.HasPrefix(strings.ToUpper(line), "RCPT TO:"):
+			if f.rcptReply != "" {
+				reply(f.rcptReply)
+				continue
+			}
+			f.rcpts = append(f.rcpts, line[len("RCPT TO:"):])
+			reply("250 ok")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			f.data = data.String()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 unknown command")
+		}
+	}
+}
+
+//httptest自带的自签名证书
+func testTLSConfig(t *testing.T) *tls.Config {
+	s := httptest.NewUnstartedServer(nil)
+	s.StartTLS()
+	defer s.Close()
+	return &tls.Config{Certificates: s.TLS.Certificates}
+}
+
+func newTestEmail(t *testing.T, host string, port int, options map[string]interface{}) *EmailNotifier {
+	options["host"] = host
+	options["port"] = port
+	options["from"] = "监控 <monitor@example.com>"
+	options["to"] = []string{"ops@example.com"}
+	options["cc"] = []string{"经理 <manager@example.com>"}
+	n, err := NewNotifier(NotifierConf{Name: "mail", Type: "email", Options: options})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n.(*EmailNotifier)
+}
+
+//解析邮件，返回主题及各部分内容
+func parseTestMail(t *testing.T, data string) (string, map[string]string) {
+	m, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	_, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := map[string]string{}
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		body, _ := ioutil.ReadAll(p)
+		parts[strings.SplitN(p.Header.Get("Content-Type"), ";", 2)[0]] = string(body)
+	}
+	return subject, parts
+}
+
+func TestEmailStartTLS(t *testing.T) {
+	f := &fakeSMTP{tls: testTLSConfig(t)}
+	host, port := newFakeSMTP(t, f, false)
+	n := newTestEmail(t, host, port, map[string]interface{}{"tls": "starttls", "insecure_skip_verify": true, "username": "u", "password": "p"})
+	msgs := testEventMsgs()
+	msgs[2].Event.Result.Duration = 1500 * time.Millisecond
+	if err := n.Notify(msgs); err != nil {
+		t.Fatal(err)
+	}
+	<-f.done
+	if !f.secure {
+		t.Error("mail sent without STARTTLS")
+	}
+	if auth, _ := base64.StdEncoding.DecodeString(f.auth); string(auth) != "\x00u\x00p" {
+		t.Errorf("auth = %q", auth)
+	}
+	if f.from != "<monitor@example.com>" || strings.Join(f.rcpts, ",") != "<ops@example.com>,<manager@example.com>" {
+		t.Errorf("from = %s, rcpts = %v", f.from, f.rcpts)
+	}
+	subject, parts := parseTestMail(t, f.data)
+	if subject != "服务监控：严重1 警告1 已恢复1" {
+		t.Errorf("subject = %q", subject)
+	}
+	for _, typ := range []string{"text/plain", "text/html"} {
+		for _, want := range []string{"Nginx", "http://192.168.1.100:80", "请求异常", "1.5s", "Redis", "检查超时", "MySQL"} {
+			if !strings.Contains(parts[typ], want) {
+				t.Errorf("%s part missing %q:\n%s", typ, want, parts[typ])
+			}
+		}
+	}
+	if !strings.Contains(parts["text/html"], `<a href="https://wiki.example.com/nginx">`) {
+		t.Errorf("html part = %s", parts["text/html"])
+	}
+}
+
+func TestEmailImplicitTLS(t *testing.T) {
+	f := &fakeSMTP{tls: testTLSConfig(t)}
+	host, port := newFakeSMTP(t, f, true)
+	n := newTestEmail(t, host, port, map[string]interface{}{"tls": "tls", "insecure_skip_verify": true})
+	if err := n.Notify(testMsgs); err != nil {
+		t.Fatal(err)
+	}
+	<-f.done
+	if f.data == "" {
+		t.Error("no mail received")
+	}
+}
+
+func TestEmailStartTLSRequired(t *testing.T) {
+	f := &fakeSMTP{}
+	host, port := newFakeSMTP(t, f, false)
+	n := newTestEmail(t, host, port, map[string]interface{}{"tls": "starttls"})
+	err := n.Notify(testMsgs)
+	<-f.done
+	if retry, _ := retryable(err); err == nil || retry || f.data != "" {
+		t.Errorf("err = %v, data = %q", err, f.data)
+	}
+}
+
+func TestEmailRcptErrors(t *testing.T) {
+	for reply, temporary := range map[string]bool{"550 no such user": false, "451 try again later": true} {
+		f := &fakeSMTP{rcptReply: reply}
+		host, port := newFakeSMTP(t, f, false)
+		n := newTestEmail(t, host, port, map[string]interface{}{"tls": "none"})
+		err := n.Notify(testMsgs)
+		<-f.done
+		if retry, _ := retryable(err); err == nil || retry != temporary {
+			t.Errorf("%s: err = %v, retry = %v", reply, err, retry)
+		}
+	}
+}
+
+func TestEmailConf(t *testing.T) {
+	base := map[string]interface{}{"host": "smtp.example.com", "from": "monitor@example.com", "to": []string{"ops@example.com"}}
+	for key, value := range map[string]interface{}{"tls": "ssl", "from": "bad address", "to": []string{}, "port": 25} {
+		options := map[string]interface{}{}
+		for k, v := range base {
+			options[k] = v
+		}
+		options[key] = value
+		_, err := NewNotifier(NotifierConf{Name: "mail", Type: "email", Options: options})
+		if (err == nil) != (key == "port") {
+			t.Errorf("%s = %v: err = %v", key, value, err)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+// escalation
+package monitor
+
+import (
+	"time"
+)
+
+//升级步骤：故障开始after后仍未确认时通知notifiers
+type EscalationStep struct {
+	After     time.Duration `yaml:"after"`
+	Notifiers []string      `yaml:"notifiers"`
+}
+
+//根据故障持续时间推进升级，返回需要发送的事件：e为本次检查的状态事件（notify为false时没有），
+//首次告警时已到期的步骤随故障告警一起发送，之后每到达一个步骤产生一个升级事件；
+//故障确认、恢复或抖动期间不升级
+func (t *Tracker) Escalate(r Result, steps []EscalationStep, e Event, notify bool) []Event {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	var events []Event
+	key := stateKey(r.Type, r.Name)
+	s, ok := t.store.Get(key)
+	if notify {
+		e.Escalation = s.Escalated
+	}
+	if ok && s.State == StateFailing && !s.Flapping && !s.acknowledged() {
+		downtime := s.LastCheck.Sub(s.FirstFailure)
+		for s.Escalated < len(steps) && downtime >= steps[s.Escalated].After {
+			s.Escalated++
+			if notify && e.Kind == EventFailing {
+				e.Escalation = s.Escalated
+				continue
+			}
+			events = append(events, Event{Kind: EventEscalated, Result: r, Failures: s.ConsecutiveFailures, Downtime: downtime, Escalation: s.Escalated})
+		}
+		t.store.Put(key, s)
+	}
+	if notify {
+		events = append([]Event{e}, events...)
+	}
+	return events
+}
@@ -0,0 +1,106 @@
+package monitor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEscalation(t *testing.T) {
+	steps := []EscalationStep{
+		{After: 0, Notifiers: []string{"ops"}},
+		{After: 15 * time.Minute, Notifiers: []string{"sre"}},
+		{After: time.Hour, Notifiers: []string{"managers"}},
+	}
+	tracker := NewTracker(NewMemoryStore())
+	policy := AlertPolicy{FailuresBeforeAlert: 1, SuccessesBeforeRecovery: 1}
+	start := time.Date(2024, 1, 1, 8, 0, 0, 0, time.Local)
+	check := func(offset time.Duration, status Status) []Event {
+		r := Result{Name: "MySQL", Type: "mysql", Status: status, Time: start.Add(offset)}
+		e, ok := tracker.Update(r, policy)
+		return tracker.Escalate(r, steps, e, ok)
+	}
+	kinds := func(events []Event) []string {
+		var s []string
+		for _, e := range events {
+			s = append(s, e.Kind.String())
+		}
+		return s
+	}
+
+	//首次告警时到期的步骤随故障告警发送
+	events := check(0, StatusFailed)
+	if len(events) != 1 || events[0].Kind != EventFailing || events[0].Escalation != 1 {
+		t.Fatalf("first failure = %v", events)
+	}
+	if events = check(10*time.Minute, StatusFailed); len(events) != 0 {
+		t.Errorf("10m = %v, want none", kinds(events))
+	}
+	events = check(16*time.Minute, StatusFailed)
+	if len(events) != 1 || events[0].Kind != EventEscalated || events[0].Escalation != 2 || events[0].Downtime != 16*time.Minute {
+		t.Fatalf("16m = %+v", events)
+	}
+
+	//确认后停止升级
+	if _, err := tracker.Ack("mysql", "MySQL", Ack{Time: start.Add(20 * time.Minute), By: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if events = check(2*time.Hour, StatusFailed); len(events) != 0 {
+		t.Errorf("acked = %v, want none", kinds(events))
+	}
+	//恢复消息发送到已升级的渠道
+	events = check(2*time.Hour+time.Minute, StatusOK)
+	if len(events) != 1 || events[0].Kind != EventRecovered || events[0].Escalation != 2 {
+		t.Fatalf("recovery = %+v", events)
+	}
+
+	//新的故障重新开始升级，长时间未检查时逐级发送
+	check(3*time.Hour, StatusFailed)
+	events = check(5*time.Hour, StatusFailed)
+	if got := kinds(events); !reflect.DeepEqual(got, []string{"escalated", "escalated"}) || events[1].Escalation != 3 {
+		t.Errorf("catch up = %v", got)
+	}
+}
+
+func TestEscalationRoute(t *testing.T) {
+	rc := RouteConf{
+		Default:    []string{"ops"},
+		Escalation: "standard",
+		Rules: []Route{
+			{Types: []string{"mysql"}, Notifiers: []string{"dba"}, Escalation: "dba"},
+		},
+		Escalations: map[string][]EscalationStep{
+			"standard": {{After: 15 * time.Minute, Notifiers: []string{"sre"}}},
+			"dba":      {{After: 0, Notifiers: []string{"dba-lead"}}, {After: time.Hour, Notifiers: []string{"managers"}}},
+		},
+	}
+	db := Result{Name: "MySQL", Type: "mysql", Status: StatusFailed}
+	web := Result{Name: "Web", Type: "http", Status: StatusFailed}
+	cases := []struct {
+		e    Event
+		want []string
+	}{
+		{Event{Kind: EventFailing, Result: db, Escalation: 1}, []string{"dba", "dba-lead"}},
+		{Event{Kind: EventEscalated, Result: db, Escalation: 2}, []string{"managers"}},
+		{Event{Kind: EventRecovered, Result: db, Escalation: 2}, []string{"dba", "dba-lead", "managers"}},
+		{Event{Kind: EventFailing, Result: web}, []string{"ops"}},
+		{Event{Kind: EventEscalated, Result: web, Escalation: 1}, []string{"sre"}},
+		{Event{Kind: EventEscalated, Result: web, Escalation: 2}, []string{}},
+	}
+	for i, c := range cases {
+		if got := rc.Route(NewMessage(c.e)); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("case %d: route = %v, want %v", i, got, c.want)
+		}
+	}
+	//路由不修改配置
+	if !reflect.DeepEqual(rc.Default, []string{"ops"}) {
+		t.Errorf("default changed to %v", rc.Default)
+	}
+
+	rc.Rules[0].Escalation = "nope"
+	rc.Escalations["standard"] = append(rc.Escalations["standard"], EscalationStep{After: time.Minute, Notifiers: []string{"sre"}})
+	names := map[string]bool{"ops": true, "dba": true, "dba-lead": true, "managers": true, "sre": true}
+	if errs := rc.validate(names); len(errs) != 2 {
+		t.Errorf("validate errors = %v, want 2", errs)
+	}
+}
@@ -0,0 +1,281 @@
+// feishu
+package monitor
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//飞书接口地址，Lark（国际版）为https://open.larksuite.com/open-apis/bot/v2/hook
+var feishuBaseServer = "https://open.feishu.cn/open-apis/bot/v2/hook"
+
+const (
+	//请求体最大20KB，留出余量
+	DefaultFeishuMaxBytes = 18000
+	//单次通知默认最多拆分的消息条数
+	DefaultFeishuMaxMessages = 5
+	//每个机器人每分钟默认最多发送条数
+	DefaultFeishuRateLimit = 100
+)
+
+//消息卡片标题颜色：按本条消息中最严重的级别，全部恢复时为绿色
+var feishuTemplates = map[string]string{
+	SeverityCritical: "red",
+	SeverityWarning:  "orange",
+	SeverityInfo:     "blue",
+	"recovered":      "green",
+}
+
+func init() {
+	RegisterNotifier("feishu", func(nc NotifierConf) (Notifier, error) {
+		n := &FeishuNotifier{name: nc.Name, client: nc.client(), templates: nc.Templates}
+		if err := nc.Decode(n); err != nil {
+			return nil, err
+		}
+		if n.Token == "" {
+			return nil, fmt.Errorf("token is empty")
+		}
+		switch n.Msgtype {
+		case "", "text", "post", "interactive":
+		default:
+			return nil, fmt.Errorf("unknown msgtype %q", n.Msgtype)
+		}
+		return n, nil
+	})
+}
+
+//飞书/Lark自定义机器人
+type FeishuNotifier struct {
+	name string
+	//发送请求使用的客户端，超时由delivery.timeout配置
+	client *http.Client
+	//消息文字使用的模板
+	templates *Templates
+	//webhook地址最后一段
+	Token string `yaml:"token"`
+	//签名校验密钥，机器人安全设置为“签名校验”时配置
+	Secret string `yaml:"secret"`
+	//接口地址（不含token），默认为飞书官方地址，Lark需配置为larksuite地址
+	Url string `yaml:"url"`
+	//消息类型：post（默认，富文本）、interactive（消息卡片）、text
+	Msgtype string `yaml:"msgtype"`
+	//有故障时@的成员open_id，实例配置at_all时@所有人
+	AtUsers []string `yaml:"at_users"`
+	//单次通知最多拆分条数及每分钟最多发送条数
+	MaxMessages int `yaml:"max_messages"`
+	RateLimit   int `yaml:"rate_limit"`
+	//当前时间，用于计算签名
+	now func() time.Time
+}
+
+func (n *FeishuNotifier) Name() string { return n.name }
+
+//发送消息，限流等待不可取消，见NotifyContext
+func (n *FeishuNotifier) Notify(msgs []Message) error {
+	return n.NotifyContext(context.Background(), msgs)
+}
+
+//发送消息到飞书：按级别排序后拆分为不超过大小限制的多条消息，按机器人限流依次发送
+func (n *FeishuNotifier) NotifyContext(ctx context.Context, msgs []Message) error {
+	limiter := limiterOf("feishu/"+n.Token, positive(n.RateLimit, DefaultFeishuRateLimit), time.Minute)
+	chunks := splitChunks(n.templates, sortBySeverity(msgs), DefaultFeishuMaxBytes, positive(n.MaxMessages, DefaultFeishuMaxMessages), n.size)
+	return sendChunks(ctx, chunks, limiter, func(c msgChunk) error {
+		return n.send(n.chunkPayload(c))
+	})
+}
+
+//发送一条消息，配置了secret时附加timestamp及sign
+func (n *FeishuNotifier) send(payload map[string]interface{}) error {
+	if n.Secret != "" {
+		now := time.Now
+		if n.now != nil {
+			now = n.now
+		}
+		timestamp := strconv.FormatInt(now().Unix(), 10)
+		payload["timestamp"] = timestamp
+		payload["sign"] = feishuSign(timestamp, n.Secret)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	base := n.Url
+	if base == "" {
+		base = feishuBaseServer
+	}
+	body, err := httpPost(n.client, strings.TrimRight(base, "/")+"/"+n.Token, "application/json", string(data))
+	if err != nil {
+		return err
+	}
+	return feishuError(body)
+}
+
+//飞书签名：base64(HmacSHA256(key=timestamp+"\n"+secret, 空消息))
+func feishuSign(timestamp string, secret string) string {
+	mac := hmac.New(sha256.New, []byte(timestamp+"\n"+secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+//解析飞书返回结果，code（旧版接口为StatusCode）为0表示成功
+func feishuError(body []byte) error {
+	var resp struct {
+		Code          int    `json:"code"`
+		Msg           string `json:"msg"`
+		StatusCode    int    `json:"StatusCode"`
+		StatusMessage string `json:"StatusMessage"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return &DeliveryError{Err: fmt.Errorf("invalid feishu response %q: %v", body, err), Temporary: true}
+	}
+	code, msg := resp.Code, resp.Msg
+	if code == 0 {
+		code, msg = resp.StatusCode, resp.StatusMessage
+	}
+	switch code {
+	case 0:
+		return nil
+	case 11232:
+		//发送频率超过限制
+		return &DeliveryError{Err: fmt.Errorf("feishu rate limited: %s", msg), RateLimited: true}
+	default:
+		return &DeliveryError{Err: fmt.Errorf("feishu error %d: %s", code, msg)}
+	}
+}
+
+//消息体的字节数
+func (n *FeishuNotifier) size(c msgChunk) int {
+	data, _ := json.Marshal(n.chunkPayload(c))
+	return len(data)
+}
+
+//按msgtype生成消息体
+func (n *FeishuNotifier) chunkPayload(c msgChunk) map[string]interface{} {
+	users, all := n.at(append(c.msgs[:len(c.msgs):len(c.msgs)], c.overflow...))
+	switch n.Msgtype {
+	case "text":
+		var content = n.templates.batchTitle(c) + "\n"
+		for _, msg := range c.msgs {
+			content += msg.Title + "\n" + msg.Content + "\n"
+		}
+		if len(c.overflow) > 0 {
+			content += n.templates.overflowText(c.overflow) + "\n"
+		}
+		for _, user := range users {
+			content += fmt.Sprintf("<at user_id=\"%s\"></at>", user)
+		}
+		if all {
+			content += "<at user_id=\"all\">" + n.templates.labelText("all") + "</at>"
+		}
+		return map[string]interface{}{
+			"msg_type": "text",
+			"content":  map[string]string{"text": strings.TrimRight(content, "\n")},
+		}
+	case "interactive":
+		return map[string]interface{}{"msg_type": "interactive", "card": n.card(c, users, all)}
+	default:
+		return map[string]interface{}{
+			"msg_type": "post",
+			"content": map[string]interface{}{
+				"post": map[string]interface{}{"zh_cn": n.post(c, users, all)},
+			},
+		}
+	}
+}
+
+//富文本消息：每个级别一行标题，下面逐行列出实例、目标及错误（见line.feishu_post模板），配置了处理手册时附加链接
+func (n *FeishuNotifier) post(c msgChunk, users []string, all bool) map[string]interface{} {
+	text := func(s string) map[string]string { return map[string]string{"tag": "text", "text": s} }
+	separator := n.templates.render("line.separator", nil)
+	var lines [][]map[string]string
+	for _, g := range GroupBySeverity(c.msgs) {
+		lines = append(lines, []map[string]string{text("【" + n.templates.groupTitle(g) + "】")})
+		for _, msg := range g.Msgs {
+			line := []map[string]string{text(n.templates.lineText("line.feishu_post", msg, false))}
+			if r := msg.Event.Result; r.Name != "" && r.Info.Runbook != "" {
+				line = append(line, text(separator), map[string]string{"tag": "a", "text": n.templates.labelText("runbook"), "href": r.Info.Runbook})
+			}
+			if msg.AckURL != "" {
+				line = append(line, text(separator), map[string]string{"tag": "a", "text": n.templates.labelText("ack"), "href": msg.AckURL})
+			}
+			lines = append(lines, line)
+		}
+	}
+	if len(c.overflow) > 0 {
+		lines = append(lines, []map[string]string{text(n.templates.overflowText(c.overflow))})
+	}
+	var at []map[string]string
+	for _, user := range users {
+		at = append(at, map[string]string{"tag": "at", "user_id": user})
+	}
+	if all {
+		at = append(at, map[string]string{"tag": "at", "user_id": "all"})
+	}
+	if len(at) > 0 {
+		lines = append(lines, at)
+	}
+	return map[string]interface{}{"title": n.templates.batchTitle(c), "content": lines}
+}
+
+//消息卡片：标题颜色按最严重的级别，每个级别一段markdown，每行见line.feishu模板
+func (n *FeishuNotifier) card(c msgChunk, users []string, all bool) map[string]interface{} {
+	groups := GroupBySeverity(c.msgs)
+	template := feishuTemplates[SeverityInfo]
+	if len(groups) > 0 {
+		if t, ok := feishuTemplates[groups[0].Severity]; ok {
+			template = t
+		}
+	}
+	div := func(md string) map[string]interface{} {
+		return map[string]interface{}{"tag": "div", "text": map[string]string{"tag": "lark_md", "content": md}}
+	}
+	var elements []map[string]interface{}
+	for _, g := range groups {
+		var b strings.Builder
+		fmt.Fprintf(&b, "**%s**", n.templates.groupTitle(g))
+		for _, msg := range g.Msgs {
+			b.WriteString("\n" + n.templates.lineText("line.feishu", msg, true))
+		}
+		elements = append(elements, div(b.String()))
+	}
+	if len(c.overflow) > 0 {
+		elements = append(elements, div(n.templates.overflowText(c.overflow)))
+	}
+	var at string
+	for _, user := range users {
+		at += fmt.Sprintf("<at id=%s></at>", user)
+	}
+	if all {
+		at += "<at id=all></at>"
+	}
+	if at != "" {
+		elements = append(elements, div(at))
+	}
+	return map[string]interface{}{
+		"config": map[string]bool{"wide_screen_mode": true},
+		"header": map[string]interface{}{
+			"title":    map[string]string{"tag": "plain_text", "content": n.templates.batchTitle(c)},
+			"template": template,
+		},
+		"elements": elements,
+	}
+}
+
+//有故障消息时需要@的成员及是否@所有人，只有恢复消息时不提醒
+func (n *FeishuNotifier) at(msgs []Message) (users []string, all bool) {
+	for _, msg := range msgs {
+		if msg.Severity() == "recovered" {
+			continue
+		}
+		users = n.AtUsers
+		all = all || msg.Event.Result.Info.AtAll
+	}
+	return users, all
+}
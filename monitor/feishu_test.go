@@ -0,0 +1,114 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+//本地模拟的飞书机器人接口，按飞书规则校验签名
+type fakeFeishu struct {
+	token  string
+	secret string
+	now    time.Time
+	//收到的消息体及拒绝原因
+	payloads []map[string]interface{}
+	rejected []string
+}
+
+func (f *fakeFeishu) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reply := func(code int, msg string) {
+		if code != 0 {
+			f.rejected = append(f.rejected, msg)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"code": code, "msg": msg})
+	}
+	if r.URL.Path != "/"+f.token {
+		reply(19001, "param invalid: incoming webhook access token invalid")
+		return
+	}
+	var payload map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		reply(9499, "Bad Request")
+		return
+	}
+	if f.secret != "" {
+		timestamp, _ := payload["timestamp"].(string)
+		ts, err := strconv.ParseInt(timestamp, 10, 64)
+		//飞书要求timestamp与服务器时间相差不超过1小时
+		if err != nil || f.now.Sub(time.Unix(ts, 0)) > time.Hour || time.Unix(ts, 0).Sub(f.now) > time.Hour {
+			reply(19021, "sign match fail or timestamp is not within one hour from current time")
+			return
+		}
+		if payload["sign"] != feishuSign(timestamp, f.secret) {
+			reply(19021, "sign match fail or timestamp is not within one hour from current time")
+			return
+		}
+	}
+	f.payloads = append(f.payloads, payload)
+	reply(0, "success")
+}
+
+//指向模拟服务的飞书渠道，签名时间使用模拟服务的时间
+func newTestFeishu(t *testing.T, fake *fakeFeishu, options map[string]interface{}) (*FeishuNotifier, func()) {
+	n, stop := newTestNotifier(t, "feishu", fake, "url", options)
+	f := n.(*FeishuNotifier)
+	f.now = func() time.Time { return fake.now }
+	return f, stop
+}
+
+func TestFeishuSign(t *testing.T) {
+	//与飞书文档中的算法独立计算的结果对照
+	got := feishuSign("1599360473", "demo")
+	want := "l1N0gAcBjdwBvGm1xMjOF0XSyaLRpR7tuO5dHfhAYc8="
+	if got != want {
+		t.Errorf("feishuSign = %s, want %s", got, want)
+	}
+}
+
+func TestFeishuSigned(t *testing.T) {
+	fake := &fakeFeishu{token: "hook1", secret: "sec", now: time.Now()}
+	n, stop := newTestFeishu(t, fake, map[string]interface{}{"token": "hook1", "secret": "sec"})
+	defer stop()
+	if err := n.Notify(testEventMsgs()); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.rejected) != 0 || len(fake.payloads) != 1 || fake.payloads[0]["msg_type"] != "post" {
+		t.Fatalf("payloads = %v, rejected = %q", fake.payloads, fake.rejected)
+	}
+	data, _ := json.Marshal(fake.payloads[0])
+	for _, want := range []string{"服务监控：严重1 警告1 已恢复1", `"href":"https://wiki.example.com/nginx"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("post missing %q: %s", want, data)
+		}
+	}
+}
+
+func TestFeishuWrongSecret(t *testing.T) {
+	fake := &fakeFeishu{token: "hook2", secret: "sec", now: time.Now()}
+	n, stop := newTestFeishu(t, fake, map[string]interface{}{"token": "hook2", "secret": "other"})
+	defer stop()
+	err := n.Notify(testMsgs)
+	if retry, _ := retryable(err); err == nil || retry || len(fake.payloads) != 0 {
+		t.Errorf("err = %v, payloads = %v", err, fake.payloads)
+	}
+}
+
+func TestFeishuCardTemplate(t *testing.T) {
+	n := &FeishuNotifier{Msgtype: "interactive"}
+	msgs := testEventMsgs()
+	template := func(msgs []Message) interface{} {
+		card := n.chunkPayload(msgChunk{msgs: msgs})["card"].(map[string]interface{})
+		return card["header"].(map[string]interface{})["template"]
+	}
+	//故障为红色，只有恢复时为绿色
+	if got := template(msgs); got != "red" {
+		t.Errorf("down template = %v", got)
+	}
+	if got := template(msgs[1:2]); got != "green" {
+		t.Errorf("recovered template = %v", got)
+	}
+}
@@ -0,0 +1,88 @@
+// http
+package monitor
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+)
+
+func init() {
+	Register("http", "HTTP", func(conf *Conf) []Checker {
+		var checkers []Checker
+		for _, inst := range conf.Instances.Http {
+			checkers = append(checkers, NewHttpChecker(conf, inst))
+		}
+		return checkers
+	})
+}
+
+//Http检查器
+type HttpChecker struct {
+	base
+	inst HttpInstance
+	//各次检查共用的客户端，不保持空闲连接，每次检查都重新建立连接
+	client *http.Client
+}
+
+func NewHttpChecker(conf *Conf, inst HttpInstance) *HttpChecker {
+	if inst.StatusCode == 0 {
+		inst.StatusCode = 200
+	}
+	timeout := conf.TimeoutOf(inst.Timeout)
+	return &HttpChecker{
+		base: base{
+			name:     inst.Name,
+			target:   inst.Url,
+			interval: conf.IntervalOf(inst.Interval),
+			timeout:  timeout,
+			policy:   conf.PolicyOf(inst.PolicyConf),
+			info:     inst.AlertInfo.withDefaults(),
+		},
+		inst: inst,
+		client: &http.Client{
+			Timeout: timeout.Total,
+			Transport: &http.Transport{
+				Proxy:             http.ProxyFromEnvironment,
+				DialContext:       (&net.Dialer{Timeout: timeout.Connect}).DialContext,
+				DisableKeepAlives: true,
+			},
+		},
+	}
+}
+
+func (c *HttpChecker) Type() string { return "http" }
+
+//请求url，校验状态码及响应内容
+func (c *HttpChecker) Check(ctx context.Context) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout.Total)
+	defer cancel()
+	req, err := http.NewRequest("GET", c.inst.Url, nil)
+	if err != nil {
+		return c.fail(c.Type(), "error", err)
+	}
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return c.fail(c.Type(), "request", err)
+	}
+	defer resp.Body.Close()
+	if c.inst.StatusCode != resp.StatusCode {
+		return c.fail(c.Type(), "status", errors.New(resp.Status))
+	}
+	if c.inst.ContentMatch != "" {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return c.fail(c.Type(), "error", err)
+		}
+		match, err := regexp.MatchString(c.inst.ContentMatch, string(body))
+		if err != nil {
+			return c.fail(c.Type(), "error", err)
+		} else if !match {
+			return c.fail(c.Type(), "mismatch", nil)
+		}
+	}
+	return c.ok(c.Type())
+}
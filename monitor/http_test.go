@@ -0,0 +1,53 @@
+package monitor
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHttpCheckerClosesConnections(t *testing.T) {
+	var lock sync.Mutex
+	open := 0
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("<title>login</title>"))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		lock.Lock()
+		defer lock.Unlock()
+		switch state {
+		case http.StateNew:
+			open++
+		case http.StateClosed, http.StateHijacked:
+			open--
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	conf := &Conf{Timeout: Timeout{Connect: time.Second, Total: time.Second}}
+	c := NewHttpChecker(conf, HttpInstance{Name: "Web", Url: server.URL, ContentMatch: "login"})
+	for i := 0; i < 3; i++ {
+		if r := c.Check(context.Background()); !r.OK() {
+			t.Fatalf("check %d: %s", i, r.Message)
+		}
+	}
+	//检查结束后不保留空闲连接
+	deadline := time.Now().Add(time.Second)
+	for {
+		lock.Lock()
+		n := open
+		lock.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d connections left open after checks", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,25 @@
+// log
+package monitor
+
+import (
+	log "github.com/cihub/seelog"
+)
+
+//初始化日志配置，输出到控制台及./out.log
+func InitLogFileWriter() {
+	logConfig := `
+		<seelog>
+		    <outputs formatid="main">   
+				<console/>
+		        <buffered size="10" flushperiod="10">
+					<file path="./out.log" />
+				</buffered>
+		    </outputs>
+		    <formats>
+		        <format id="main" format="%Date %Time [%LEV] %Msg%n"/>
+		    </formats>
+		</seelog>
+	`
+	logger, _ := log.LoggerFromConfigAsBytes([]byte(logConfig))
+	log.ReplaceLogger(logger)
+}
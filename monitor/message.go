@@ -0,0 +1,64 @@
+// message
+package monitor
+
+import (
+	"sync"
+
+	log "github.com/cihub/seelog"
+)
+
+//消息
+type Message struct {
+	Title   string
+	Content string
+	//产生消息的事件，测试消息等手动构造的消息为零值
+	Event Event
+	//故障确认链接，见ack配置
+	AckURL string
+}
+
+//根据事件生成消息，使用默认语言
+func NewMessage(e Event) Message {
+	return defaultTemplates.message(e)
+}
+
+//根据事件生成消息
+func (t *Templates) message(e Event) Message {
+	return Message{Title: t.title(e.Result), Content: t.content(e), Event: e}
+}
+
+//test-notify命令发送的测试消息，见test.*模板
+func (t *Templates) TestMessage(hostname string) Message {
+	data := map[string]interface{}{"Hostname": hostname}
+	return Message{Title: t.render("test.title", data), Content: t.render("test.content", data)}
+}
+
+//消息队列，并发安全
+type MsgQueue struct {
+	lock sync.Mutex
+	msgs []Message
+}
+
+//追加消息
+func (q *MsgQueue) Append(m Message) {
+	q.lock.Lock()
+	q.msgs = append(q.msgs, m)
+	q.lock.Unlock()
+	log.Info(m.Title, " ", m.Content)
+}
+
+//取出全部消息并清空队列
+func (q *MsgQueue) Drain() []Message {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	msgs := q.msgs
+	q.msgs = nil
+	return msgs
+}
+
+//队列中的消息数
+func (q *MsgQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.msgs)
+}
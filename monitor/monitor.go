@@ -0,0 +1,356 @@
+// monitor
+package monitor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+//监控：通过工作池执行检查，收集失败消息并推送
+type Monitor struct {
+	Conf      *Conf
+	Checkers  []Checker
+	slots     chan struct{}
+	msgs      MsgQueue
+	tracker   *Tracker
+	notifiers []Notifier
+	//各检查最近一次结果，用于生成汇总
+	latestLock sync.Mutex
+	latest     map[string]Result
+	//修改临时静默时加锁
+	silenceLock sync.Mutex
+	//实例依赖关系
+	deps dependencies
+	//串行发送消息，同一时间只有一次发送读写暂存目录
+	sendLock sync.Mutex
+	//守护进程模式下通知发送协程的唤醒信号
+	pending chan struct{}
+	//按language及templates配置加载的模板
+	templates *Templates
+}
+
+//根据配置创建监控，types为空时检查全部已注册类型
+func New(conf *Conf, types ...string) *Monitor {
+	workers := conf.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	templates, err := LoadTemplates(conf.Language, conf.Templates)
+	if err != nil {
+		log.Errorf("Load templates error, use default templates: %v", err)
+		templates = defaultTemplates
+	}
+	store, err := OpenStore(conf.State)
+	if err != nil {
+		log.Errorf("Open state store error, state will not be persisted: %v", err)
+		store = NewMemoryStore()
+	}
+	notifiers, err := NewNotifiers(conf, templates)
+	if err != nil {
+		log.Errorf("Create notifiers error: %v", err)
+	}
+	m := &Monitor{
+		Conf:      conf,
+		Checkers:  NewCheckers(conf, types...),
+		slots:     make(chan struct{}, workers),
+		notifiers: notifiers,
+		latest:    map[string]Result{},
+		templates: templates,
+	}
+	//依赖关系按全部实例建立，只检查部分类型时仍能判断上游状态；引用错误由Validate报告
+	m.deps, _ = newDependencies(NewCheckers(conf))
+	m.UseStore(store)
+	return m
+}
+
+//替换状态存储，需在开始检查前调用
+func (m *Monitor) UseStore(store Store) {
+	m.tracker = NewTracker(store)
+	for _, n := range m.notifiers {
+		if s, ok := n.(Storer); ok {
+			s.UseStore(store)
+		}
+	}
+}
+
+//执行检查并记录结果，失败时按策略重试
+func (m *Monitor) Check(ctx context.Context, c Checker) Result {
+	policy := m.policyOf(c)
+	start := time.Now()
+	var r Result
+	for attempt := 1; ; attempt++ {
+		r = m.attempt(ctx, c)
+		r.Message = m.templates.checkText(r)
+		r.Attempts = attempt
+		if r.OK() || attempt > policy.Retries {
+			break
+		}
+		log.Warnf("%s attempt %d/%d failed: %s, retry in %v", m.templates.title(r), attempt, policy.Retries+1, r.Message, policy.RetryDelay)
+		if !sleep(ctx, policy.RetryDelay) {
+			break
+		}
+	}
+	r.Time = start
+	r.Duration = time.Since(start)
+	r.Info = AlertInfo{}.withDefaults()
+	if ai, ok := c.(AlertInfoer); ok {
+		r.Info = ai.AlertInfo()
+	}
+	m.record(r, policy)
+	return r
+}
+
+//占用一个工作槽执行一次检查，池满时阻塞等待；重试等待期间不占用工作槽
+func (m *Monitor) attempt(ctx context.Context, c Checker) Result {
+	m.slots <- struct{}{}
+	defer func() { <-m.slots }()
+	return c.Check(ctx)
+}
+
+//检查器的告警策略
+func (m *Monitor) policyOf(c Checker) AlertPolicy {
+	if p, ok := c.(Policier); ok {
+		return p.Policy()
+	}
+	return m.Conf.PolicyOf(PolicyConf{})
+}
+
+//记录检查结果，状态变化时加入待发送消息
+func (m *Monitor) record(r Result, policy AlertPolicy) {
+	if r.OK() {
+		log.Info(m.templates.title(r), r.Message)
+	} else if r.Err != nil {
+		log.Errorf("%s %s after %d attempts: %v", m.templates.title(r), r.Status, r.Attempts, r.Err)
+	} else {
+		log.Errorf("%s %s after %d attempts: %s", m.templates.title(r), r.Status, r.Attempts, r.Message)
+	}
+	m.latestLock.Lock()
+	m.latest[stateKey(r.Type, r.Name)] = r
+	m.latestLock.Unlock()
+	e, ok := m.tracker.Update(r, policy)
+	if s := m.silenceOf(r, time.Now()); s != nil {
+		if ok {
+			log.Infof("Silenced by %s: %s %s", s.ID, m.templates.title(r), m.templates.content(e))
+			m.tracker.setSilenced(r)
+		}
+		return
+	}
+	var parent *Result
+	if !r.OK() {
+		parent = m.downParent(stateKey(r.Type, r.Name))
+	}
+	if !ok && parent == nil {
+		//静默结束或上游恢复后仍故障时补发
+		e, ok = m.tracker.unsilence(r)
+	}
+	for _, e := range m.tracker.Escalate(r, m.Conf.Routes.EscalationOf(r), e, ok) {
+		if parent != nil && e.Kind != EventRecovered && e.Kind != EventStabilized {
+			log.Warnf("%s unreachable due to parent %s", m.templates.title(r), m.templates.title(*parent))
+			e.Parent = parent
+			m.tracker.setSilenced(r)
+			m.msgs.Append(m.templates.message(e))
+			continue
+		}
+		m.msgs.Append(m.ackLink(m.templates.message(e)))
+	}
+}
+
+//并发执行一次全部检查，输出运行报告，有消息时推送
+func (m *Monitor) RunOnce(ctx context.Context) []Result {
+	results := make([]Result, len(m.Checkers))
+	//按依赖分层，上游检查完成后再检查下游
+	for _, level := range m.deps.levels(m.Checkers) {
+		var wg sync.WaitGroup
+		for _, i := range level {
+			wg.Add(1)
+			go func(i int, c Checker) {
+				defer wg.Done()
+				results[i] = m.Check(ctx, c)
+			}(i, m.Checkers[i])
+		}
+		wg.Wait()
+	}
+	var ok, failed, timeout int
+	for _, r := range results {
+		switch r.Status {
+		case StatusOK:
+			ok++
+		case StatusTimeout:
+			timeout++
+		default:
+			failed++
+		}
+	}
+	log.Infof("Checked %d instances: %d ok, %d failed, %d timeout", len(results), ok, failed, timeout)
+	m.send(context.Background(), append(m.msgs.Drain(), m.reportMsgs(time.Now())...))
+	m.saveState()
+	return results
+}
+
+//守护进程模式：每个实例按各自间隔循环检查，ctx结束后等待进行中的检查完成再返回
+func (m *Monitor) RunDaemon(ctx context.Context) {
+	if len(m.Checkers) == 0 {
+		log.Warn("No instances configured, daemon exit")
+		return
+	}
+	//ack、silence命令据此判断不能直接修改状态存储
+	defer m.Conf.writePidFile()()
+	m.pending = make(chan struct{}, 1)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.sendLoop(ctx)
+	}()
+	for _, c := range m.Checkers {
+		interval := m.Conf.IntervalOf(0)
+		if i, ok := c.(Intervaler); ok && i.Interval() > 0 {
+			interval = i.Interval()
+		}
+		log.Infof("Schedule %s -> %s every %v", TypeLabel(c.Type()), c.Name(), interval)
+		wg.Add(1)
+		go func(c Checker, interval time.Duration) {
+			defer wg.Done()
+			m.schedule(ctx, c, interval)
+		}(c, interval)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.reportLoop(ctx)
+	}()
+	if m.Conf.Ack.Listen != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.serveHTTP(ctx)
+		}()
+	}
+	<-ctx.Done()
+	log.Info("Waiting for in-flight checks")
+	wg.Wait()
+	//ctx已结束：每条消息只尝试发送一次，不再重试及等待限流，未送达的写入暂存目录
+	m.flush(ctx)
+	log.Info("Daemon stopped")
+}
+
+//按间隔执行检查，直到ctx结束；进行中的检查不受ctx取消影响
+func (m *Monitor) schedule(ctx context.Context, c Checker, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if r := m.Check(context.Background(), c); !r.OK() {
+			m.checkChildren(context.Background(), c)
+		}
+		m.wakeSender()
+		m.saveState()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			//ctx与ticker同时就绪时优先退出
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}
+}
+
+//守护进程模式下的通知发送协程：检查协程只收集消息，发送、重试及重发暂存消息都在此进行，渠道故障不会推迟检查
+func (m *Monitor) sendLoop(ctx context.Context) {
+	//重发上次退出前未送达的消息
+	m.send(ctx, nil)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.pending:
+			m.flush(ctx)
+		}
+	}
+}
+
+//唤醒通知发送协程，已有未处理的唤醒时直接返回
+func (m *Monitor) wakeSender() {
+	select {
+	case m.pending <- struct{}{}:
+	default:
+	}
+}
+
+//发送已收集的消息，没有消息时不发送
+func (m *Monitor) Flush() {
+	m.flush(context.Background())
+}
+
+//发送已收集的消息，ctx结束时不再等待重试及限流
+func (m *Monitor) flush(ctx context.Context) {
+	if m.msgs.Len() == 0 {
+		return
+	}
+	m.send(ctx, m.msgs.Drain())
+}
+
+//先重发暂存的未送达消息，再发送msgs到全部渠道；单个渠道失败不影响其他渠道，
+//最终仍失败（或ctx结束时未送达）的消息写入暂存目录，渠道有未送达消息时新消息直接暂存以保证顺序
+func (m *Monitor) send(ctx context.Context, msgs []Message) {
+	m.sendLock.Lock()
+	defer m.sendLock.Unlock()
+	d := m.Conf.Delivery.withDefaults()
+	var outbox *Outbox
+	if d.Outbox != "" {
+		outbox = NewOutbox(d.Outbox, d.OutboxMaxAge)
+		outbox.Replay(ctx, m.notifiers, d)
+	}
+	if len(msgs) == 0 {
+		return
+	}
+	routed := m.Conf.Routes.split(msgs, m.notifiers)
+	for _, n := range m.notifiers {
+		msgs := groupUnreachable(m.templates, routed[n.Name()])
+		if len(msgs) == 0 {
+			continue
+		}
+		if outbox != nil && outbox.Pending(n.Name()) {
+			m.spool(outbox, n, msgs)
+			continue
+		}
+		if rest, err := deliver(ctx, n, msgs, d); err != nil {
+			log.Errorf("Notify %s error: %v", n.Name(), err)
+			if outbox != nil {
+				m.spool(outbox, n, rest)
+			}
+		}
+	}
+}
+
+//暂存未送达的消息
+func (m *Monitor) spool(outbox *Outbox, n Notifier, msgs []Message) {
+	if err := outbox.Spool(n.Name(), msgs); err != nil {
+		log.Errorf("Spool messages for %s error, %d messages lost: %v", n.Name(), len(msgs), err)
+		return
+	}
+	log.Warnf("Spooled %d messages for %s to outbox", len(msgs), n.Name())
+}
+
+//持久化检查状态
+func (m *Monitor) saveState() {
+	if err := m.tracker.store.Flush(); err != nil {
+		log.Errorf("Save state error: %v", err)
+	}
+}
+
+//等待d，ctx提前结束时返回false
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,94 @@
+package monitor
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//按间隔调度并记录检查次数的检查器
+type countChecker struct {
+	fakeChecker
+	interval time.Duration
+	checks   int32
+}
+
+func (c *countChecker) Interval() time.Duration { return c.interval }
+func (c *countChecker) Check(ctx context.Context) Result {
+	atomic.AddInt32(&c.checks, 1)
+	return c.fakeChecker.Check(ctx)
+}
+
+func (c *countChecker) count() int {
+	return int(atomic.LoadInt32(&c.checks))
+}
+
+//守护进程按各实例的interval循环检查，ctx取消后停止调度并退出
+func TestRunDaemon(t *testing.T) {
+	path, cleanup := tempStatePath(t)
+	defer cleanup()
+	fast := &countChecker{fakeChecker: fakeChecker{name: "Fast", status: StatusOK}, interval: 20 * time.Millisecond}
+	slow := &countChecker{fakeChecker: fakeChecker{name: "Slow", status: StatusOK}, interval: 100 * time.Millisecond}
+	m := newAckMonitor(fast, &recordNotifier{})
+	m.Checkers = append(m.Checkers, slow)
+	m.Conf.State.Path = path
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.RunDaemon(ctx)
+		close(done)
+	}()
+	time.Sleep(250 * time.Millisecond)
+	//运行期间写入进程号文件
+	if _, err := os.Stat(m.Conf.pidFile()); err != nil {
+		t.Errorf("pid file: %v", err)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("daemon did not stop after cancel")
+	}
+
+	//启动时立即检查一次，之后每个间隔一次
+	if n := fast.count(); n < 6 || n > 14 {
+		t.Errorf("fast checks = %d, want about 13", n)
+	}
+	if n := slow.count(); n < 2 || n > 4 {
+		t.Errorf("slow checks = %d, want about 3", n)
+	}
+	stopped := fast.count() + slow.count()
+	time.Sleep(60 * time.Millisecond)
+	if n := fast.count() + slow.count(); n != stopped {
+		t.Errorf("checks after stop = %d, want %d", n, stopped)
+	}
+	if _, err := os.Stat(m.Conf.pidFile()); !os.IsNotExist(err) {
+		t.Errorf("pid file left after stop: %v", err)
+	}
+}
+
+//重试等待期间释放工作槽，其他检查不必等待重试结束
+func TestCheckRetryReleasesSlot(t *testing.T) {
+	retries, delay := 1, 300*time.Millisecond
+	down := &countChecker{fakeChecker: fakeChecker{name: "Down", status: StatusFailed}}
+	up := &countChecker{fakeChecker: fakeChecker{name: "Up", status: StatusOK}}
+	m := newAckMonitor(down, &recordNotifier{})
+	m.Conf.PolicyConf = PolicyConf{Retries: &retries, RetryDelay: &delay}
+
+	retried := make(chan Result)
+	go func() { retried <- m.Check(context.Background(), down) }()
+	for down.count() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	start := time.Now()
+	m.Check(context.Background(), up)
+	if elapsed := time.Since(start); elapsed >= delay/2 {
+		t.Errorf("check waited %v for the retry delay", elapsed)
+	}
+	if r := <-retried; r.Attempts != 2 || down.count() != 2 {
+		t.Errorf("attempts = %d, checks = %d, want 2", r.Attempts, down.count())
+	}
+}
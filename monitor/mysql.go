@@ -0,0 +1,64 @@
+// mysql
+package monitor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+var validation_sql_mysql = "select 1"
+
+func init() {
+	Register("mysql", "MySQL", func(conf *Conf) []Checker {
+		var checkers []Checker
+		for _, inst := range conf.Instances.Mysql {
+			checkers = append(checkers, NewMysqlChecker(conf, inst))
+		}
+		return checkers
+	})
+}
+
+//MySQL检查器
+type MysqlChecker struct {
+	base
+	inst MysqlInstance
+}
+
+func NewMysqlChecker(conf *Conf, inst MysqlInstance) *MysqlChecker {
+	return &MysqlChecker{
+		base: base{
+			name:     inst.Name,
+			target:   net.JoinHostPort(inst.Host, inst.Port),
+			interval: conf.IntervalOf(inst.Interval),
+			timeout:  conf.TimeoutOf(inst.Timeout),
+			policy:   conf.PolicyOf(inst.PolicyConf),
+			info:     inst.AlertInfo.withDefaults(),
+		},
+		inst: inst,
+	}
+}
+
+func (c *MysqlChecker) Type() string { return "mysql" }
+
+//连接数据库并执行校验SQL
+func (c *MysqlChecker) Check(ctx context.Context) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout.Total)
+	defer cancel()
+	dataSource := fmt.Sprintf("%s:%s@tcp(%s)/?charset=utf8&timeout=%s&readTimeout=%s&writeTimeout=%s",
+		c.inst.User, c.inst.Pass, c.target, c.timeout.Connect, c.timeout.Total, c.timeout.Total)
+	db, err := sql.Open("mysql", dataSource)
+	if err != nil {
+		return c.fail(c.Type(), "connect", err)
+	}
+	defer db.Close()
+	rows, err := db.QueryContext(ctx, validation_sql_mysql)
+	if err != nil {
+		return c.fail(c.Type(), "query", err)
+	}
+	defer rows.Close()
+	return c.ok(c.Type())
+}
@@ -0,0 +1,155 @@
+// notifier
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+//通知渠道
+type Notifier interface {
+	//渠道名称，对应配置中的name
+	Name() string
+	//发送一批消息
+	Notify(msgs []Message) error
+}
+
+//可选接口：发送过程中需要等待（如按机器人限流）的渠道，ctx结束时停止等待并返回未送达的消息，
+//守护进程退出时据此不再等待，剩余消息写入暂存目录
+type ContextNotifier interface {
+	NotifyContext(ctx context.Context, msgs []Message) error
+}
+
+//发送一批消息，渠道实现了ContextNotifier时可被ctx取消
+func notify(ctx context.Context, n Notifier, msgs []Message) error {
+	if cn, ok := n.(ContextNotifier); ok {
+		return cn.NotifyContext(ctx, msgs)
+	}
+	return n.Notify(msgs)
+}
+
+//可选接口：需要持久化数据的渠道，如记录故障消息所在的会话以便恢复时回复，数据通过Store的GetData、PutData保存
+type Storer interface {
+	UseStore(store Store)
+}
+
+//通知渠道配置，除公共字段外的配置项由各类型自行解析
+type NotifierConf struct {
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+	//是否启用，未配置时启用
+	Enabled *bool                  `yaml:"enabled"`
+	Options map[string]interface{} `yaml:",inline"`
+	//单次发送超时，由delivery.timeout设置，为0时使用默认值
+	Timeout time.Duration `yaml:"-"`
+	//消息文字使用的模板，为nil时使用默认语言
+	Templates *Templates `yaml:"-"`
+}
+
+//是否启用
+func (nc NotifierConf) IsEnabled() bool {
+	return nc.Enabled == nil || *nc.Enabled
+}
+
+//单次发送超时
+func (nc NotifierConf) timeout() time.Duration {
+	if nc.Timeout > 0 {
+		return nc.Timeout
+	}
+	return DefaultDeliveryTimeout
+}
+
+//渠道发送请求使用的客户端
+func (nc NotifierConf) client() *http.Client {
+	return &http.Client{Timeout: nc.timeout()}
+}
+
+//将配置项解析到out
+func (nc NotifierConf) Decode(out interface{}) error {
+	data, err := yaml.Marshal(nc.Options)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(data, out)
+}
+
+//通知渠道工厂
+type NotifierFactory func(nc NotifierConf) (Notifier, error)
+
+var notifierTypes = map[string]NotifierFactory{}
+
+//注册通知渠道类型
+func RegisterNotifier(typ string, factory NotifierFactory) {
+	notifierTypes[typ] = factory
+}
+
+//已注册的通知渠道类型
+func NotifierTypes() []string {
+	types := make([]string, 0, len(notifierTypes))
+	for typ := range notifierTypes {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	return types
+}
+
+//通知渠道配置列表，兼容旧的ddRobotToken配置
+func (conf *Conf) NotifierConfs() []NotifierConf {
+	ncs := conf.Notifiers
+	if conf.DdRobotToken != "" {
+		ncs = append([]NotifierConf{{
+			Name: "dingtalk",
+			Type: "dingtalk",
+			Options: map[string]interface{}{
+				"token":   conf.DdRobotToken,
+				"secret":  conf.DdRobotSecret,
+				"keyword": conf.DdRobotKeyword,
+			},
+		}}, ncs...)
+	}
+	return ncs
+}
+
+//根据配置创建已启用的通知渠道，消息文字使用模板t
+func NewNotifiers(conf *Conf, t *Templates) ([]Notifier, error) {
+	var (
+		notifiers []Notifier
+		errs      []string
+	)
+	for _, nc := range conf.NotifierConfs() {
+		if !nc.IsEnabled() {
+			continue
+		}
+		nc.Timeout = conf.Delivery.withDefaults().Timeout
+		nc.Templates = t
+		n, err := NewNotifier(nc)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		notifiers = append(notifiers, n)
+	}
+	if len(errs) > 0 {
+		return notifiers, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return notifiers, nil
+}
+
+//创建单个通知渠道
+func NewNotifier(nc NotifierConf) (Notifier, error) {
+	factory, ok := notifierTypes[nc.Type]
+	if !ok {
+		return nil, fmt.Errorf("notifier %q: unknown type %q", nc.Name, nc.Type)
+	}
+	n, err := factory(nc)
+	if err != nil {
+		return nil, fmt.Errorf("notifier %q: %v", nc.Name, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,21 @@
+package monitor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+//启动模拟的渠道服务并创建指向它的通知渠道：服务地址写入urlKey配置项，该配置项原有的值作为路径附加在地址后；
+//返回的函数关闭服务
+func newTestNotifier(t *testing.T, typ string, handler http.Handler, urlKey string, options map[string]interface{}) (Notifier, func()) {
+	server := httptest.NewServer(handler)
+	path, _ := options[urlKey].(string)
+	options[urlKey] = server.URL + path
+	n, err := NewNotifier(NotifierConf{Name: "test", Type: typ, Options: options})
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	return n, server.Close
+}
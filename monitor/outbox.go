@@ -0,0 +1,155 @@
+// outbox
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+//暂存的未送达消息
+type outboxEntry struct {
+	Notifier string    `json:"notifier"`
+	Created  time.Time `json:"created"`
+	Msgs     []Message `json:"msgs"`
+	//暂存文件路径
+	path string
+}
+
+//未送达消息暂存目录，每批消息一个文件，下次发送前按时间顺序重发
+type Outbox struct {
+	dir    string
+	maxAge time.Duration
+}
+
+func NewOutbox(dir string, maxAge time.Duration) *Outbox {
+	return &Outbox{dir: dir, maxAge: maxAge}
+}
+
+//暂存发送失败的消息
+func (o *Outbox) Spool(notifier string, msgs []Message) error {
+	if err := os.MkdirAll(o.dir, 0755); err != nil {
+		return err
+	}
+	now := time.Now()
+	data, err := json.Marshal(outboxEntry{Notifier: notifier, Created: now, Msgs: msgs})
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.json", now.UnixNano(), safeFileName(notifier))
+	tmp := filepath.Join(o.dir, "."+name)
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(o.dir, name))
+}
+
+//按暂存时间顺序读取全部消息，过期及无法解析的文件直接删除
+func (o *Outbox) entries() []outboxEntry {
+	files, err := ioutil.ReadDir(o.dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("Read outbox error: %v", err)
+		}
+		return nil
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+	var entries []outboxEntry
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(o.dir, f.Name())
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Errorf("Read outbox error: %v", err)
+			continue
+		}
+		var e outboxEntry
+		if err = json.Unmarshal(data, &e); err != nil {
+			log.Errorf("Drop invalid outbox file %s: %v", path, err)
+			os.Remove(path)
+			continue
+		}
+		if time.Since(e.Created) > o.maxAge {
+			log.Warnf("Drop expired outbox file %s created at %v", path, e.Created)
+			os.Remove(path)
+			continue
+		}
+		e.path = path
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+//重发暂存的消息，成功后删除；某个渠道仍失败时保留该渠道剩余的消息以保证顺序
+func (o *Outbox) Replay(ctx context.Context, notifiers []Notifier, d DeliveryConf) {
+	byName := map[string]Notifier{}
+	for _, n := range notifiers {
+		byName[n.Name()] = n
+	}
+	failed := map[string]bool{}
+	for _, e := range o.entries() {
+		n, ok := byName[e.Notifier]
+		if !ok || failed[e.Notifier] {
+			continue
+		}
+		rest, err := deliver(ctx, n, e.Msgs, d)
+		if err != nil {
+			log.Errorf("Replay outbox %s to %s error: %v", e.path, e.Notifier, err)
+			failed[e.Notifier] = true
+			//部分送达时只保留未送达的消息
+			if len(rest) < len(e.Msgs) {
+				e.Msgs = rest
+				if err = o.rewrite(e); err != nil {
+					log.Errorf("Rewrite outbox %s error: %v", e.path, err)
+				}
+			}
+			continue
+		}
+		log.Infof("Replayed outbox %s to %s", e.path, e.Notifier)
+		os.Remove(e.path)
+	}
+}
+
+//更新暂存文件的内容
+func (o *Outbox) rewrite(e outboxEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	dir, name := filepath.Split(e.path)
+	tmp := filepath.Join(dir, "."+name)
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, e.path)
+}
+
+//是否还有notifier未送达的消息
+func (o *Outbox) Pending(notifier string) bool {
+	for _, e := range o.entries() {
+		if e.Notifier == notifier {
+			return true
+		}
+	}
+	return false
+}
+
+//文件名中只保留字母数字及-_
+func safeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, s)
+}
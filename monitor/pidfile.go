@@ -0,0 +1,64 @@
+// pidfile
+package monitor
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	log "github.com/cihub/seelog"
+)
+
+//守护进程的进程号文件，位于状态文件旁，如state.json.pid
+func (conf *Conf) pidFile() string {
+	path := conf.State.Path
+	if path == "" {
+		path = DefaultStateFile
+	}
+	return path + ".pid"
+}
+
+//使用同一状态存储的守护进程的进程号，没有运行时返回0；
+//守护进程在内存中维护状态并定期整体写回，此时其他进程直接修改状态存储会被覆盖
+func DaemonPid(conf *Conf) int {
+	data, err := ioutil.ReadFile(conf.pidFile())
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 || !processAlive(pid) {
+		return 0
+	}
+	return pid
+}
+
+//进程是否存在；windows不支持信号0，只要进程号文件存在即视为运行中
+func processAlive(pid int) bool {
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
+
+//写入进程号文件，返回退出时的清理函数
+func (conf *Conf) writePidFile() func() {
+	path := conf.pidFile()
+	if pid := DaemonPid(conf); pid != 0 && pid != os.Getpid() {
+		log.Warnf("Another daemon (pid %d) is using the same state %s", pid, path)
+	}
+	if err := ioutil.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+		log.Errorf("Write pid file error: %v", err)
+		return func() {}
+	}
+	return func() {
+		os.Remove(path)
+	}
+}
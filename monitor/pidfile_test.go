@@ -0,0 +1,34 @@
+package monitor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestDaemonPid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf := &Conf{State: StateConf{Path: filepath.Join(dir, "state.json")}}
+	if pid := DaemonPid(conf); pid != 0 {
+		t.Errorf("pid without daemon = %d", pid)
+	}
+	cleanup := conf.writePidFile()
+	if pid := DaemonPid(conf); pid != os.Getpid() {
+		t.Errorf("pid = %d, want %d", pid, os.Getpid())
+	}
+	cleanup()
+	if pid := DaemonPid(conf); pid != 0 {
+		t.Errorf("pid after cleanup = %d", pid)
+	}
+	//进程已退出时忽略残留的进程号文件
+	ioutil.WriteFile(conf.pidFile(), []byte(strconv.Itoa(1<<22+12345)), 0644)
+	if pid := DaemonPid(conf); pid != 0 {
+		t.Errorf("stale pid = %d", pid)
+	}
+}
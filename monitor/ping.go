@@ -0,0 +1,76 @@
+// ping
+package monitor
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	Register("ping", "PING", func(conf *Conf) []Checker {
+		var checkers []Checker
+		for _, inst := range conf.Instances.Ping {
+			checkers = append(checkers, NewPingChecker(conf, inst))
+		}
+		return checkers
+	})
+}
+
+//主机检查器，调用系统ping命令，常作为同一主机上其他实例的depends_on
+type PingChecker struct {
+	base
+	inst PingInstance
+}
+
+func NewPingChecker(conf *Conf, inst PingInstance) *PingChecker {
+	return &PingChecker{
+		base: base{
+			name:     inst.Name,
+			target:   inst.Host,
+			interval: conf.IntervalOf(inst.Interval),
+			timeout:  conf.TimeoutOf(inst.Timeout),
+			policy:   conf.PolicyOf(inst.PolicyConf),
+			info:     inst.AlertInfo.withDefaults(),
+		},
+		inst: inst,
+	}
+}
+
+func (c *PingChecker) Type() string { return "ping" }
+
+//发送count个（默认3个）ICMP请求，全部无响应时失败
+func (c *PingChecker) Check(ctx context.Context) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout.Total)
+	defer cancel()
+	count := c.inst.Count
+	if count <= 0 {
+		count = DefaultPingCount
+	}
+	out, err := exec.CommandContext(ctx, "ping", pingArgs(c.inst.Host, count, c.timeout)...).CombinedOutput()
+	if ctx.Err() != nil {
+		return c.fail(c.Type(), "unreachable", ctx.Err())
+	}
+	if err != nil {
+		//ping的输出最后一行通常为丢包统计或错误原因
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		return c.fail(c.Type(), "unreachable", errors.New(strings.TrimSpace(lines[len(lines)-1])))
+	}
+	return c.ok(c.Type())
+}
+
+//ping命令参数：每个请求的等待时间为connect超时
+func pingArgs(host string, count int, timeout Timeout) []string {
+	n := strconv.Itoa(count)
+	if runtime.GOOS == "windows" {
+		return []string{"-n", n, "-w", strconv.FormatInt(timeout.Connect.Milliseconds(), 10), host}
+	}
+	wait := int(timeout.Connect.Seconds())
+	if wait < 1 {
+		wait = 1
+	}
+	return []string{"-c", n, "-W", strconv.Itoa(wait), host}
+}
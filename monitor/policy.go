@@ -0,0 +1,108 @@
+// policy
+package monitor
+
+import (
+	"time"
+)
+
+const (
+	//未配置retry_delay时的默认重试间隔
+	DefaultRetryDelay = time.Second
+	//默认抖动阈值（状态变化百分比）
+	DefaultFlapHighThreshold = 50
+	DefaultFlapLowThreshold  = 25
+)
+
+//告警策略，由PolicyOf合并实例配置、全局配置及默认值得到
+type AlertPolicy struct {
+	//单次检查失败后的重试次数及间隔
+	Retries    int
+	RetryDelay time.Duration
+	//连续失败多少次后告警，至少1
+	FailuresBeforeAlert int
+	//故障后连续成功多少次视为恢复，至少1
+	SuccessesBeforeRecovery int
+	//故障持续期间重复通知的间隔，0为不重复
+	RepeatInterval time.Duration
+	//抖动检测：最近FlapWindow次结果中状态变化比例达到high时进入抖动，低于low时恢复稳定；0为不检测
+	FlapWindow        int
+	FlapHighThreshold float64
+	FlapLowThreshold  float64
+}
+
+//告警策略配置，可全局配置，也可按实例覆盖；未配置的项为nil，配置为0时同样覆盖全局配置，
+//如全局repeat_interval: 30m时实例可配置repeat_interval: 0关闭重复通知
+type PolicyConf struct {
+	//单次检查失败后的重试次数及间隔，默认不重试、间隔1s
+	Retries    *int           `yaml:"retries"`
+	RetryDelay *time.Duration `yaml:"retry_delay"`
+	//连续失败多少次后告警，默认1
+	FailuresBeforeAlert *int `yaml:"failures_before_alert"`
+	//故障后连续成功多少次视为恢复，默认1
+	SuccessesBeforeRecovery *int `yaml:"successes_before_recovery"`
+	//故障持续期间重复通知的间隔，默认不重复
+	RepeatInterval *time.Duration `yaml:"repeat_interval"`
+	//抖动检测窗口及阈值（状态变化百分比），默认不检测
+	FlapWindow        *int     `yaml:"flap_window"`
+	FlapHighThreshold *float64 `yaml:"flap_high_threshold"`
+	FlapLowThreshold  *float64 `yaml:"flap_low_threshold"`
+}
+
+//可选接口：声明实例的告警策略，未实现时使用全局策略
+type Policier interface {
+	Policy() AlertPolicy
+}
+
+//实例策略 > 全局策略 > 默认值
+func (conf *Conf) PolicyOf(p PolicyConf) AlertPolicy {
+	global := conf.PolicyConf
+	policy := AlertPolicy{
+		Retries:                 intOf(0, p.Retries, global.Retries),
+		RetryDelay:              durationOf(DefaultRetryDelay, p.RetryDelay, global.RetryDelay),
+		FailuresBeforeAlert:     intOf(1, p.FailuresBeforeAlert, global.FailuresBeforeAlert),
+		SuccessesBeforeRecovery: intOf(1, p.SuccessesBeforeRecovery, global.SuccessesBeforeRecovery),
+		RepeatInterval:          durationOf(0, p.RepeatInterval, global.RepeatInterval),
+		FlapWindow:              intOf(0, p.FlapWindow, global.FlapWindow),
+		FlapHighThreshold:       floatOf(DefaultFlapHighThreshold, p.FlapHighThreshold, global.FlapHighThreshold),
+		FlapLowThreshold:        floatOf(DefaultFlapLowThreshold, p.FlapLowThreshold, global.FlapLowThreshold),
+	}
+	//阈值至少为1次，否则首次检查前就已告警或恢复
+	if policy.FailuresBeforeAlert < 1 {
+		policy.FailuresBeforeAlert = 1
+	}
+	if policy.SuccessesBeforeRecovery < 1 {
+		policy.SuccessesBeforeRecovery = 1
+	}
+	if policy.Retries < 0 {
+		policy.Retries = 0
+	}
+	return policy
+}
+
+//第一个已配置的值，都未配置时返回默认值
+func intOf(def int, values ...*int) int {
+	for _, v := range values {
+		if v != nil {
+			return *v
+		}
+	}
+	return def
+}
+
+func durationOf(def time.Duration, values ...*time.Duration) time.Duration {
+	for _, v := range values {
+		if v != nil {
+			return *v
+		}
+	}
+	return def
+}
+
+func floatOf(def float64, values ...*float64) float64 {
+	for _, v := range values {
+		if v != nil {
+			return *v
+		}
+	}
+	return def
+}
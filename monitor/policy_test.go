@@ -0,0 +1,136 @@
+package monitor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestPolicyOf(t *testing.T) {
+	var conf Conf
+	err := yaml.Unmarshal([]byte(`
+retries: 2
+repeat_interval: 30m
+failures_before_alert: 3
+flap_window: 10
+instances:
+  tcp:
+    - name: Inherit
+      host: 127.0.0.1
+      port: 1
+    - name: Zero
+      host: 127.0.0.1
+      port: 2
+      retries: 0
+      repeat_interval: 0
+      flap_window: 0
+    - name: Override
+      host: 127.0.0.1
+      port: 3
+      failures_before_alert: 5
+      successes_before_recovery: 2
+      retry_delay: 0s
+`), &conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcp := conf.Instances.TCP
+	for _, c := range []struct {
+		name string
+		got  AlertPolicy
+		want AlertPolicy
+	}{
+		{"Inherit", conf.PolicyOf(tcp[0].PolicyConf), AlertPolicy{Retries: 2, RetryDelay: DefaultRetryDelay, FailuresBeforeAlert: 3, SuccessesBeforeRecovery: 1,
+			RepeatInterval: 30 * time.Minute, FlapWindow: 10, FlapHighThreshold: DefaultFlapHighThreshold, FlapLowThreshold: DefaultFlapLowThreshold}},
+		//配置为0时覆盖非0的全局配置
+		{"Zero", conf.PolicyOf(tcp[1].PolicyConf), AlertPolicy{Retries: 0, RetryDelay: DefaultRetryDelay, FailuresBeforeAlert: 3, SuccessesBeforeRecovery: 1,
+			RepeatInterval: 0, FlapWindow: 0, FlapHighThreshold: DefaultFlapHighThreshold, FlapLowThreshold: DefaultFlapLowThreshold}},
+		{"Override", conf.PolicyOf(tcp[2].PolicyConf), AlertPolicy{Retries: 2, RetryDelay: 0, FailuresBeforeAlert: 5, SuccessesBeforeRecovery: 2,
+			RepeatInterval: 30 * time.Minute, FlapWindow: 10, FlapHighThreshold: DefaultFlapHighThreshold, FlapLowThreshold: DefaultFlapLowThreshold}},
+		//未配置时为默认值，阈值至少为1
+		{"default", (&Conf{}).PolicyOf(PolicyConf{}), AlertPolicy{RetryDelay: DefaultRetryDelay, FailuresBeforeAlert: 1, SuccessesBeforeRecovery: 1,
+			FlapHighThreshold: DefaultFlapHighThreshold, FlapLowThreshold: DefaultFlapLowThreshold}},
+		{"minimum", (&Conf{}).PolicyOf(PolicyConf{FailuresBeforeAlert: new(int), SuccessesBeforeRecovery: new(int)}),
+			AlertPolicy{RetryDelay: DefaultRetryDelay, FailuresBeforeAlert: 1, SuccessesBeforeRecovery: 1,
+				FlapHighThreshold: DefaultFlapHighThreshold, FlapLowThreshold: DefaultFlapLowThreshold}},
+	} {
+		if !reflect.DeepEqual(c.got, c.want) {
+			t.Errorf("%s policy = %+v, want %+v", c.name, c.got, c.want)
+		}
+	}
+}
+
+//连续失败达到failures_before_alert才告警，故障后连续成功达到successes_before_recovery才恢复
+func TestPolicyThresholds(t *testing.T) {
+	policy := AlertPolicy{FailuresBeforeAlert: 3, SuccessesBeforeRecovery: 2}
+	for _, c := range []struct {
+		name  string
+		steps []trackerStep
+		want  []string
+	}{
+		{"below alert threshold", []trackerStep{{0, false}, {time.Minute, false}, {2 * time.Minute, true}},
+			[]string{"-", "-", "-"}},
+		{"alert threshold", []trackerStep{{0, false}, {time.Minute, false}, {2 * time.Minute, false}, {3 * time.Minute, false}},
+			[]string{"-", "-", "failing", "-"}},
+		//中间成功一次时重新计数
+		{"failures reset", []trackerStep{{0, false}, {time.Minute, false}, {2 * time.Minute, true}, {3 * time.Minute, false}, {4 * time.Minute, false}},
+			[]string{"-", "-", "-", "-", "-"}},
+		{"recovery threshold", []trackerStep{{0, false}, {time.Minute, false}, {2 * time.Minute, false}, {3 * time.Minute, true}, {4 * time.Minute, true}},
+			[]string{"-", "-", "failing", "-", "recovered"}},
+		{"successes reset", []trackerStep{{0, false}, {time.Minute, false}, {2 * time.Minute, false}, {3 * time.Minute, true}, {4 * time.Minute, false}, {5 * time.Minute, true}},
+			[]string{"-", "-", "failing", "-", "-", "-"}},
+	} {
+		if got, _ := runTracker(policy, c.steps); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestValidatePolicy(t *testing.T) {
+	var conf Conf
+	err := yaml.Unmarshal([]byte(`
+flap_window: -1
+flap_high_threshold: 20
+instances:
+  tcp:
+    - name: Range
+      host: 127.0.0.1
+      port: 1
+      flap_high_threshold: 120
+      flap_low_threshold: -5
+    - name: Inverted
+      host: 127.0.0.1
+      port: 2
+      flap_high_threshold: 40
+      flap_low_threshold: 60
+    - name: Valid
+      host: 127.0.0.1
+      port: 3
+      flap_window: 10
+      flap_high_threshold: 60
+      flap_low_threshold: 30
+`), &conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, err := range conf.Validate() {
+		if strings.Contains(err.Error(), "flap_") {
+			got = append(got, err.Error())
+		}
+	}
+	want := []string{
+		"flap_window must not be negative",
+		//全局进入阈值20低于默认退出阈值25
+		"flap_low_threshold 25 is higher than flap_high_threshold 20",
+		`tcp "Range": flap_high_threshold must be between 0 and 100`,
+		`tcp "Range": flap_low_threshold must be between 0 and 100`,
+		`tcp "Inverted": flap_low_threshold 60 is higher than flap_high_threshold 40`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("errors = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,74 @@
+// redis
+package monitor
+
+import (
+	"context"
+	"net"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func init() {
+	Register("redis", "Redis", func(conf *Conf) []Checker {
+		var checkers []Checker
+		for _, inst := range conf.Instances.Redis {
+			checkers = append(checkers, NewRedisChecker(conf, inst))
+		}
+		return checkers
+	})
+}
+
+//Redis检查器
+type RedisChecker struct {
+	base
+	inst RedisInstance
+}
+
+func NewRedisChecker(conf *Conf, inst RedisInstance) *RedisChecker {
+	return &RedisChecker{
+		base: base{
+			name:     inst.Name,
+			target:   net.JoinHostPort(inst.Host, inst.Port),
+			interval: conf.IntervalOf(inst.Interval),
+			timeout:  conf.TimeoutOf(inst.Timeout),
+			policy:   conf.PolicyOf(inst.PolicyConf),
+			info:     inst.AlertInfo.withDefaults(),
+		},
+		inst: inst,
+	}
+}
+
+func (c *RedisChecker) Type() string { return "redis" }
+
+//连接Redis，按需AUTH后写入测试键
+func (c *RedisChecker) Check(ctx context.Context) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout.Total)
+	defer cancel()
+	conn, err := redis.Dial("tcp", c.target,
+		redis.DialConnectTimeout(c.timeout.Connect),
+		redis.DialReadTimeout(c.timeout.Total),
+		redis.DialWriteTimeout(c.timeout.Total))
+	if err != nil {
+		return c.fail(c.Type(), "connect", err)
+	}
+	defer conn.Close()
+	//ctx取消时关闭连接以中断阻塞的命令
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+	if c.inst.Pass != "" {
+		if _, err = conn.Do("AUTH", c.inst.Pass); err != nil {
+			return c.fail(c.Type(), "error", ctxErr(ctx, err))
+		}
+	}
+	if _, err = conn.Do("SET", "GO_TEST_KEY", 123456); err != nil {
+		return c.fail(c.Type(), "error", ctxErr(ctx, err))
+	}
+	return c.ok(c.Type())
+}
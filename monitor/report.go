@@ -0,0 +1,142 @@
+// report
+package monitor
+
+import (
+	"context"
+	"os"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+//报告模式
+const (
+	//只在告警状态变化时通知（默认）
+	ReportFailuresOnly = "failures_only"
+	//每次运行都发送汇总，全部正常时发送“全部N个检查正常”
+	ReportAlways = "always"
+	//告警之外每天定时发送一次健康汇总
+	ReportDigest = "digest"
+)
+
+const (
+	//默认每日汇总时间
+	DefaultDigestTime = "09:00"
+	//状态存储中每日汇总发送记录的名称
+	digestKey = "digest"
+)
+
+//每日汇总的发送记录
+type digestState struct {
+	LastSent time.Time `json:"last_sent"`
+}
+
+//汇总中每种类型的检查数
+type summaryCount struct {
+	TypeLabel string
+	Total     int
+	Failed    int
+}
+
+//运行汇总消息：各类型检查数及异常实例，标题及内容见summary.*模板
+func (m *Monitor) summary(mode string) Message {
+	m.latestLock.Lock()
+	results := make([]Result, 0, len(m.latest))
+	for _, r := range m.latest {
+		results = append(results, r)
+	}
+	m.latestLock.Unlock()
+
+	total := map[string]int{}
+	failed := map[string]int{}
+	var failures []string
+	now := time.Now()
+	for _, r := range results {
+		total[r.Type]++
+		if !r.OK() {
+			failed[r.Type]++
+			failure := m.templates.title(r) + " " + r.Message
+			if m.silenceOf(r, now) != nil {
+				failure += m.templates.labelText("silenced")
+			}
+			failures = append(failures, failure)
+		}
+	}
+	var counts []summaryCount
+	for _, typ := range Types() {
+		if total[typ] > 0 {
+			counts = append(counts, summaryCount{TypeLabel(typ), total[typ], failed[typ]})
+		}
+	}
+	hostname, _ := os.Hostname()
+	title := m.templates.render("summary.title", map[string]interface{}{"Mode": mode, "Hostname": hostname})
+	content := m.templates.render("summary.content", map[string]interface{}{"Total": len(results), "Counts": counts, "Failures": failures})
+	return Message{Title: title, Content: content, Event: Event{Kind: EventSummary}}
+}
+
+//本次运行需要附加的汇总消息
+func (m *Monitor) reportMsgs(now time.Time) []Message {
+	switch m.Conf.ReportMode {
+	case ReportAlways:
+		return []Message{m.summary(ReportAlways)}
+	case ReportDigest:
+		if m.digestDue(now) {
+			return []Message{m.summary(ReportDigest)}
+		}
+	}
+	return nil
+}
+
+//是否到了发送每日汇总的时间：已过今天的digest_time且今天尚未发送，到期时记录发送时间
+func (m *Monitor) digestDue(now time.Time) bool {
+	digestTime := m.Conf.DigestTime
+	if digestTime == "" {
+		digestTime = DefaultDigestTime
+	}
+	at, err := time.ParseInLocation("15:04", digestTime, now.Location())
+	if err != nil {
+		log.Errorf("Invalid digest_time %q: %v", digestTime, err)
+		return false
+	}
+	scheduled := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())
+	if now.Before(scheduled) {
+		return false
+	}
+	var last digestState
+	if _, err := m.tracker.store.GetData(digestKey, &last); err != nil {
+		log.Errorf("Read digest state error: %v", err)
+	}
+	if !last.LastSent.Before(scheduled) {
+		return false
+	}
+	if err := m.tracker.store.PutData(digestKey, digestState{LastSent: now}); err != nil {
+		log.Errorf("Save digest state error: %v", err)
+	}
+	return true
+}
+
+//守护进程模式下定时发送汇总：always按全局interval，digest每分钟检查是否到期
+func (m *Monitor) reportLoop(ctx context.Context) {
+	var interval time.Duration
+	switch m.Conf.ReportMode {
+	case ReportAlways:
+		interval = m.Conf.IntervalOf(0)
+	case ReportDigest:
+		interval = time.Minute
+	default:
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if msgs := m.reportMsgs(now); len(msgs) > 0 {
+				m.send(ctx, msgs)
+				m.saveState()
+			}
+		}
+	}
+}
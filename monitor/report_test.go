@@ -0,0 +1,34 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDigestDue(t *testing.T) {
+	m := &Monitor{Conf: &Conf{DigestTime: "09:00"}, latest: map[string]Result{}}
+	m.UseStore(NewMemoryStore())
+	at := func(s string) time.Time {
+		t, _ := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+		return t
+	}
+	cases := []struct {
+		now  string
+		want bool
+	}{
+		{"2024-05-01 08:59", false},
+		{"2024-05-01 09:00", true},
+		//当天已发送
+		{"2024-05-01 09:01", false},
+		{"2024-05-01 23:00", false},
+		//次日到期后发送一次
+		{"2024-05-02 08:00", false},
+		{"2024-05-02 10:30", true},
+		{"2024-05-02 10:31", false},
+	}
+	for _, c := range cases {
+		if got := m.digestDue(at(c.now)); got != c.want {
+			t.Errorf("digestDue(%s) = %v, want %v", c.now, got, c.want)
+		}
+	}
+}
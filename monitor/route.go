@@ -0,0 +1,211 @@
+// route
+package monitor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//告警路由配置，未配置时消息发送到全部渠道
+type RouteConf struct {
+	//未匹配任何规则的消息发送到的渠道，为空时发送到全部渠道
+	Default []string `yaml:"default"`
+	//按顺序匹配的规则
+	Rules []Route `yaml:"rules"`
+	//未匹配任何规则或匹配的规则未指定升级策略时使用的升级策略
+	Escalation string `yaml:"escalation"`
+	//升级策略，名称 -> 升级步骤
+	Escalations map[string][]EscalationStep `yaml:"escalations"`
+}
+
+//路由规则，各匹配条件均满足时消息发送到notifiers
+type Route struct {
+	//实例标签，全部相同时匹配，值为*时只要求存在该标签
+	Match map[string]string `yaml:"match"`
+	//检查类型，为空时不限
+	Types []string `yaml:"types"`
+	//实例告警级别，为空时不限
+	Severities []string `yaml:"severities"`
+	Notifiers  []string `yaml:"notifiers"`
+	//匹配后是否继续匹配后续规则，默认匹配到第一条规则即停止
+	Continue bool `yaml:"continue"`
+	//故障未确认时的升级策略
+	Escalation string `yaml:"escalation"`
+}
+
+//是否配置了路由
+func (rc RouteConf) IsEmpty() bool {
+	return len(rc.Default) == 0 && len(rc.Rules) == 0 && rc.Escalation == ""
+}
+
+//规则是否匹配检查结果
+func (rt Route) matches(r Result) bool {
+	if len(rt.Types) > 0 && !contains(rt.Types, r.Type) {
+		return false
+	}
+	if len(rt.Severities) > 0 && !contains(rt.Severities, r.Info.withDefaults().Severity) {
+		return false
+	}
+	return matchTags(rt.Match, r.Info.Tags)
+}
+
+//标签是否全部匹配，值为*时只要求存在该标签
+func matchTags(match map[string]string, tags map[string]string) bool {
+	for k, v := range match {
+		tag, ok := tags[k]
+		if !ok || (v != "*" && v != tag) {
+			return false
+		}
+	}
+	return true
+}
+
+//按规则匹配检查结果，返回匹配规则的渠道及升级策略，未匹配任何规则时使用默认值
+func (rc RouteConf) match(r Result) (names []string, escalation string) {
+	matched := false
+	for _, rt := range rc.Rules {
+		if !rt.matches(r) {
+			continue
+		}
+		matched = true
+		for _, name := range rt.Notifiers {
+			if !contains(names, name) {
+				names = append(names, name)
+			}
+		}
+		if escalation == "" {
+			escalation = rt.Escalation
+		}
+		if !rt.Continue {
+			break
+		}
+	}
+	if !matched {
+		names = append([]string(nil), rc.Default...)
+	}
+	if escalation == "" {
+		escalation = rc.Escalation
+	}
+	return names, escalation
+}
+
+//消息发送到的渠道名称，返回nil表示全部渠道
+//测试消息、运行汇总等不属于某个实例的消息总是发送到全部渠道；
+//升级消息只发送到该升级步骤的渠道，其他消息同时发送到本次故障已升级到的渠道
+func (rc RouteConf) Route(msg Message) []string {
+	r := msg.Event.Result
+	if rc.IsEmpty() || r.Name == "" {
+		return nil
+	}
+	names, escalation := rc.match(r)
+	steps := rc.Escalations[escalation]
+	if msg.Event.Kind == EventEscalated {
+		if i := msg.Event.Escalation - 1; i >= 0 && i < len(steps) {
+			return steps[i].Notifiers
+		}
+		return []string{}
+	}
+	if names == nil {
+		return nil
+	}
+	for i := 0; i < msg.Event.Escalation && i < len(steps); i++ {
+		for _, name := range steps[i].Notifiers {
+			if !contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+//检查结果适用的升级步骤，未配置时返回nil
+func (rc RouteConf) EscalationOf(r Result) []EscalationStep {
+	if rc.IsEmpty() {
+		return nil
+	}
+	_, escalation := rc.match(r)
+	return rc.Escalations[escalation]
+}
+
+//按渠道拆分消息，保持原有顺序
+func (rc RouteConf) split(msgs []Message, notifiers []Notifier) map[string][]Message {
+	routed := make(map[string][]Message, len(notifiers))
+	for _, msg := range msgs {
+		names := rc.Route(msg)
+		for _, n := range notifiers {
+			if names == nil || contains(names, n.Name()) {
+				routed[n.Name()] = append(routed[n.Name()], msg)
+			}
+		}
+	}
+	return routed
+}
+
+//校验路由配置，names为已配置的渠道名称
+func (rc RouteConf) validate(names map[string]bool) []error {
+	var errs []error
+	checkNames := func(where string, notifiers []string) {
+		for _, name := range notifiers {
+			if !names[name] {
+				errs = append(errs, fmt.Errorf("%s: unknown notifier %q", where, name))
+			}
+		}
+	}
+	checkNames("routes.default", rc.Default)
+	checkEscalation := func(where string, escalation string) {
+		if _, ok := rc.Escalations[escalation]; escalation != "" && !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown escalation %q", where, escalation))
+		}
+	}
+	checkEscalation("routes", rc.Escalation)
+	escalations := make([]string, 0, len(rc.Escalations))
+	for name := range rc.Escalations {
+		escalations = append(escalations, name)
+	}
+	sort.Strings(escalations)
+	for _, name := range escalations {
+		steps := rc.Escalations[name]
+		for i, step := range steps {
+			where := fmt.Sprintf("routes.escalations.%s[%d]", name, i)
+			if len(step.Notifiers) == 0 {
+				errs = append(errs, fmt.Errorf("%s: no notifier", where))
+			}
+			checkNames(where, step.Notifiers)
+			if step.After < 0 || (i > 0 && step.After < steps[i-1].After) {
+				errs = append(errs, fmt.Errorf("%s: after must be ascending and not negative", where))
+			}
+		}
+	}
+	types := Types()
+	for i, rt := range rc.Rules {
+		where := fmt.Sprintf("routes.rules[%d]", i)
+		if len(rt.Notifiers) == 0 {
+			errs = append(errs, fmt.Errorf("%s: no notifier", where))
+		}
+		checkNames(where, rt.Notifiers)
+		checkEscalation(where, rt.Escalation)
+		for _, typ := range rt.Types {
+			if !contains(types, typ) {
+				errs = append(errs, fmt.Errorf("%s: unknown type %q, supported: %s", where, typ, strings.Join(types, ", ")))
+			}
+		}
+		for _, s := range rt.Severities {
+			switch s {
+			case SeverityCritical, SeverityWarning, SeverityInfo:
+			default:
+				errs = append(errs, fmt.Errorf("%s: unknown severity %q", where, s))
+			}
+		}
+	}
+	return errs
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package monitor
+
+import (
+	"reflect"
+	"testing"
+)
+
+//只记录名称的通知渠道
+type namedNotifier string
+
+func (n namedNotifier) Name() string                { return string(n) }
+func (n namedNotifier) Notify(msgs []Message) error { return nil }
+
+func routeMsg(typ string, name string, severity string, tags map[string]string) Message {
+	r := Result{Name: name, Type: typ, Status: StatusFailed, Info: AlertInfo{Severity: severity, Tags: tags}}
+	return NewMessage(Event{Kind: EventFailing, Result: r, Failures: 1})
+}
+
+func TestRoute(t *testing.T) {
+	rc := RouteConf{
+		Default: []string{"ops"},
+		Rules: []Route{
+			{Types: []string{"mysql"}, Notifiers: []string{"dba"}},
+			{Match: map[string]string{"team": "frontend"}, Notifiers: []string{"frontend"}, Continue: true},
+			{Match: map[string]string{"env": "prod"}, Severities: []string{SeverityCritical}, Notifiers: []string{"oncall", "frontend"}},
+		},
+	}
+	cases := []struct {
+		msg  Message
+		want []string
+	}{
+		{routeMsg("mysql", "MySQL", "", map[string]string{"team": "frontend"}), []string{"dba"}},
+		{routeMsg("http", "Web", "", map[string]string{"team": "frontend"}), []string{"frontend"}},
+		{routeMsg("http", "Web", "", map[string]string{"team": "frontend", "env": "prod"}), []string{"frontend", "oncall"}},
+		{routeMsg("http", "Web", SeverityWarning, map[string]string{"env": "prod"}), []string{"ops"}},
+		{routeMsg("tcp", "MQ", "", nil), []string{"ops"}},
+		//不属于实例的消息发送到全部渠道
+		{Message{Title: "test", Content: "test"}, nil},
+	}
+	for i, c := range cases {
+		if got := rc.Route(c.msg); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("case %d: route = %v, want %v", i, got, c.want)
+		}
+	}
+
+	rc.Rules[1].Match["team"] = "*"
+	if got := rc.Route(routeMsg("http", "Web", "", map[string]string{"team": "backend"})); !reflect.DeepEqual(got, []string{"frontend"}) {
+		t.Errorf("wildcard route = %v", got)
+	}
+	if got := (RouteConf{}).Route(routeMsg("mysql", "MySQL", "", nil)); got != nil {
+		t.Errorf("empty routes = %v, want all", got)
+	}
+}
+
+func TestRouteSplit(t *testing.T) {
+	rc := RouteConf{Rules: []Route{{Types: []string{"mysql"}, Notifiers: []string{"dba"}}}}
+	notifiers := []Notifier{namedNotifier("dba"), namedNotifier("web")}
+	db := routeMsg("mysql", "MySQL", "", nil)
+	web := routeMsg("http", "Web", "", nil)
+	routed := rc.split([]Message{db, web}, notifiers)
+	//未配置default时未匹配的消息发送到全部渠道
+	if len(routed["dba"]) != 2 || routed["dba"][0].Event.Result.Name != "MySQL" {
+		t.Errorf("dba got %d messages", len(routed["dba"]))
+	}
+	if len(routed["web"]) != 1 || routed["web"][0].Event.Result.Name != "Web" {
+		t.Errorf("web got %d messages", len(routed["web"]))
+	}
+
+	errs := RouteConf{Default: []string{"nope"}, Rules: []Route{{Types: []string{"ftp"}, Severities: []string{"fatal"}}}}.validate(map[string]bool{"dba": true})
+	if len(errs) != 4 {
+		t.Errorf("validate errors = %v, want 4", errs)
+	}
+}
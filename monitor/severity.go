@@ -0,0 +1,108 @@
+// severity
+package monitor
+
+//告警级别
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+)
+
+//级别展示顺序，恢复类消息单独归为recovered
+var severityOrder = []string{SeverityCritical, SeverityWarning, SeverityInfo, "recovered"}
+
+//各级别在消息中的颜色
+var severityColors = map[string]string{
+	SeverityCritical: "#D9001B",
+	SeverityWarning:  "#F59A23",
+	SeverityInfo:     "#1E90FF",
+	"recovered":      "#4CAF50",
+}
+
+//告警级别展示名称，见severity.*模板，使用默认语言
+func SeverityLabel(severity string) string {
+	return defaultTemplates.severityLabel(severity)
+}
+
+//告警级别展示名称，未知级别原样返回
+func (t *Templates) severityLabel(severity string) string {
+	if !t.has("severity." + severity) {
+		return severity
+	}
+	return t.render("severity."+severity, nil)
+}
+
+//实例的告警附加信息
+type AlertInfo struct {
+	//告警级别：critical（默认）、warning、info
+	Severity string `yaml:"severity"`
+	//处理手册地址，钉钉ActionCard消息中作为按钮链接
+	Runbook string `yaml:"runbook"`
+	//告警时@的手机号及是否@所有人
+	AtMobiles []string `yaml:"at_mobiles"`
+	AtAll     bool     `yaml:"at_all"`
+	//Slack/Mattermost中发送到的频道，覆盖渠道配置的channel
+	Channel string `yaml:"channel"`
+	//实例标签，如team、env、service，用于告警路由
+	Tags map[string]string `yaml:"tags"`
+	//依赖的上游实例名称（或 类型/名称），上游故障时本实例的告警合并到上游的一条通知中
+	DependsOn []string `yaml:"depends_on"`
+}
+
+//可选接口：声明实例的告警附加信息
+type AlertInfoer interface {
+	AlertInfo() AlertInfo
+}
+
+//补全默认值
+func (info AlertInfo) withDefaults() AlertInfo {
+	if info.Severity == "" {
+		info.Severity = SeverityCritical
+	}
+	return info
+}
+
+//消息分组的级别：恢复及抖动结束消息归为recovered，其余按实例级别
+func (m Message) Severity() string {
+	switch m.Event.Kind {
+	case EventRecovered:
+		return "recovered"
+	case EventStabilized:
+		if m.Event.Result.OK() {
+			return "recovered"
+		}
+	}
+	if m.Event.Result.Info.Severity == "" {
+		return SeverityInfo
+	}
+	return m.Event.Result.Info.Severity
+}
+
+//同一级别的消息
+type SeverityGroup struct {
+	Severity string
+	Msgs     []Message
+}
+
+//按级别分组，组内保持原有顺序
+func GroupBySeverity(msgs []Message) []SeverityGroup {
+	groups := map[string][]Message{}
+	for _, msg := range msgs {
+		groups[msg.Severity()] = append(groups[msg.Severity()], msg)
+	}
+	var result []SeverityGroup
+	for _, severity := range severityOrder {
+		if len(groups[severity]) > 0 {
+			result = append(result, SeverityGroup{severity, groups[severity]})
+			delete(groups, severity)
+		}
+	}
+	//未知级别放在最后
+	for _, msg := range msgs {
+		if g, ok := groups[msg.Severity()]; ok {
+			result = append(result, SeverityGroup{msg.Severity(), g})
+			delete(groups, msg.Severity())
+		}
+	}
+	return result
+}
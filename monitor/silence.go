@@ -0,0 +1,363 @@
+// silence
+package monitor
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	//状态存储中临时静默的数据名称，内容为[]Silence
+	silenceKey = "silences"
+	//过期的临时静默保留时长，之后从状态存储中清除
+	silenceRetention = 24 * time.Hour
+)
+
+//静默（维护窗口）：时间段内匹配的实例照常检查并记录日志，但不发送通知
+type Silence struct {
+	//标识，临时静默自动生成，配置中未填写时为config-序号
+	ID string `yaml:"id" json:"id"`
+	//匹配的实例名称（或 类型/名称）、检查类型及标签，均为空时匹配全部实例
+	Names []string          `yaml:"names" json:"names,omitempty"`
+	Types []string          `yaml:"types" json:"types,omitempty"`
+	Match map[string]string `yaml:"match" json:"match,omitempty"`
+	//固定时间段，配置中格式如2024-05-01 02:00，未配置start时立即开始
+	Start time.Time `yaml:"-" json:"start"`
+	End   time.Time `yaml:"-" json:"end"`
+	//周期时间段：cron为每次的开始时间，duration为持续时长
+	Cron     string        `yaml:"cron" json:"cron,omitempty"`
+	Duration time.Duration `yaml:"duration" json:"duration,omitempty"`
+	//说明及创建人
+	Comment   string `yaml:"comment" json:"comment,omitempty"`
+	CreatedBy string `yaml:"created_by" json:"created_by,omitempty"`
+}
+
+//配置中的时间格式，均为本地时间
+var silenceTimeLayouts = []string{"2006-01-02 15:04", "2006-01-02 15:04:05", time.RFC3339}
+
+//解析配置，start、end按本地时间解析
+func (s *Silence) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Silence
+	var raw struct {
+		plain `yaml:",inline"`
+		Start string `yaml:"start"`
+		End   string `yaml:"end"`
+	}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	*s = Silence(raw.plain)
+	var err error
+	if s.Start, err = parseSilenceTime(raw.Start); err != nil {
+		return err
+	}
+	s.End, err = parseSilenceTime(raw.End)
+	return err
+}
+
+func parseSilenceTime(text string) (time.Time, error) {
+	if text == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range silenceTimeLayouts {
+		if t, err := time.ParseInLocation(layout, text, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid silence time %q, want YYYY-MM-DD HH:MM", text)
+}
+
+//校验静默配置
+func (s Silence) validate() error {
+	if s.Cron != "" {
+		if _, err := parseCron(s.Cron); err != nil {
+			return err
+		}
+		if s.Duration <= 0 {
+			return errors.New("cron silence needs a positive duration")
+		}
+		return nil
+	}
+	if s.End.IsZero() {
+		return errors.New("silence needs an end time or a cron schedule")
+	}
+	if !s.Start.IsZero() && !s.Start.Before(s.End) {
+		return errors.New("silence start must be before end")
+	}
+	return nil
+}
+
+//now时静默是否生效
+func (s Silence) Active(now time.Time) bool {
+	if s.Cron != "" {
+		spec, err := parseCron(s.Cron)
+		return err == nil && spec.within(now, s.Duration)
+	}
+	return (s.Start.IsZero() || !now.Before(s.Start)) && now.Before(s.End)
+}
+
+//是否匹配检查结果
+func (s Silence) matches(r Result) bool {
+	if len(s.Names) > 0 && !contains(s.Names, r.Name) && !contains(s.Names, stateKey(r.Type, r.Name)) {
+		return false
+	}
+	if len(s.Types) > 0 && !contains(s.Types, r.Type) {
+		return false
+	}
+	return matchTags(s.Match, r.Info.Tags)
+}
+
+//配置的静默，未填写ID时按序号生成
+func (conf *Conf) silences() []Silence {
+	silences := make([]Silence, len(conf.Silences))
+	for i, s := range conf.Silences {
+		if s.ID == "" {
+			s.ID = fmt.Sprintf("config-%d", i+1)
+		}
+		silences[i] = s
+	}
+	return silences
+}
+
+//临时静默
+func (m *Monitor) adhocSilences() []Silence {
+	var silences []Silence
+	if _, err := m.tracker.store.GetData(silenceKey, &silences); err != nil {
+		log.Errorf("Read silences error: %v", err)
+	}
+	return silences
+}
+
+//全部静默：配置的及临时创建的
+func (m *Monitor) Silences() []Silence {
+	return append(m.Conf.silences(), m.adhocSilences()...)
+}
+
+//检查结果当前生效的静默，没有时返回nil
+func (m *Monitor) silenceOf(r Result, now time.Time) *Silence {
+	for _, s := range m.Silences() {
+		if s.Active(now) && s.matches(r) {
+			return &s
+		}
+	}
+	return nil
+}
+
+//创建临时静默，未设置开始时间时立即开始
+func (m *Monitor) AddSilence(s Silence) (Silence, error) {
+	now := time.Now()
+	if s.Start.IsZero() {
+		s.Start = now
+	}
+	if s.Cron != "" {
+		return s, errors.New("cron silences can only be configured in the config file")
+	}
+	if err := s.validate(); err != nil {
+		return s, err
+	}
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return s, fmt.Errorf("generate silence id: %v", err)
+	}
+	s.ID = hex.EncodeToString(id)
+
+	m.silenceLock.Lock()
+	silences := []Silence{s}
+	//清除过期较久的静默
+	for _, old := range m.adhocSilences() {
+		if now.Sub(old.End) < silenceRetention {
+			silences = append(silences, old)
+		}
+	}
+	err := m.tracker.store.PutData(silenceKey, silences)
+	m.silenceLock.Unlock()
+	if err != nil {
+		return s, err
+	}
+
+	log.Infof("Silence %s added by %s until %s: %s", s.ID, s.CreatedBy, s.End.Format("2006-01-02 15:04:05"), s.Comment)
+	m.saveState()
+	return s, nil
+}
+
+//提前结束临时静默
+func (m *Monitor) ExpireSilence(id string) error {
+	m.silenceLock.Lock()
+	silences := m.adhocSilences()
+	found := false
+	now := time.Now()
+	for i, s := range silences {
+		if s.ID == id && now.Before(s.End) {
+			silences[i].End = now
+			found = true
+		}
+	}
+	var err error
+	if found {
+		err = m.tracker.store.PutData(silenceKey, silences)
+	}
+	m.silenceLock.Unlock()
+	if !found {
+		return fmt.Errorf("no active ad hoc silence %q", id)
+	}
+	if err != nil {
+		return err
+	}
+	log.Infof("Silence %s expired", id)
+	m.saveState()
+	return nil
+}
+
+//记录静默或上游故障期间有未单独发送的通知
+func (t *Tracker) setSilenced(r Result) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	key := stateKey(r.Type, r.Name)
+	if s, ok := t.store.Get(key); ok {
+		s.Silenced = true
+		t.store.Put(key, s)
+	}
+}
+
+//静默结束或上游恢复后的首次检查：仍故障且未确认时补发一次重复通知，否则只清除标记
+func (t *Tracker) unsilence(r Result) (Event, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	key := stateKey(r.Type, r.Name)
+	s, ok := t.store.Get(key)
+	if !ok || !s.Silenced {
+		return Event{}, false
+	}
+	s.Silenced = false
+	notify := s.State == StateFailing && s.Ack == nil
+	if notify {
+		s.LastNotified = s.LastCheck
+	}
+	t.store.Put(key, s)
+	if !notify {
+		return Event{}, false
+	}
+	return Event{Kind: EventRepeat, Result: r, Failures: s.ConsecutiveFailures, Downtime: s.LastCheck.Sub(s.FirstFailure)}, true
+}
+
+//创建静默的请求，for为从开始时间起的持续时长，如2h，与end二选一
+type silenceRequest struct {
+	Silence
+	For string `json:"for"`
+}
+
+//静默接口：GET列出全部静默，POST创建临时静默，DELETE ?id= 提前结束临时静默；
+//请求需带头 Authorization: Bearer <ack.secret>
+func (m *Monitor) silencesHandler(w http.ResponseWriter, req *http.Request) {
+	secret := m.Conf.Ack.Secret
+	if secret == "" || !hmac.Equal([]byte(req.Header.Get("Authorization")), []byte("Bearer "+secret)) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch req.Method {
+	case http.MethodGet:
+		writeJSON(w, m.Silences())
+	case http.MethodPost:
+		var sr silenceRequest
+		if err := json.NewDecoder(req.Body).Decode(&sr); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s := sr.Silence
+		if sr.For != "" {
+			d, err := time.ParseDuration(sr.For)
+			if err != nil || d <= 0 {
+				http.Error(w, fmt.Sprintf("invalid for %q", sr.For), http.StatusBadRequest)
+				return
+			}
+			if s.Start.IsZero() {
+				s.Start = time.Now()
+			}
+			s.End = s.Start.Add(d)
+		}
+		s, err := m.AddSilence(s)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, s)
+	case http.MethodDelete:
+		if err := m.ExpireSilence(req.URL.Query().Get("id")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(v)
+}
+
+//通过守护进程的静默接口发送请求，out不为nil时解析返回的JSON
+func silenceAPI(c AckConf, method string, query string, in interface{}, out interface{}) error {
+	base, err := c.localURL()
+	if err != nil {
+		return err
+	}
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, base+"/silences"+query, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Secret)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := daemonClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request daemon error, is the daemon running: %v", err)
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(strings.TrimSpace(string(data)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+//silence命令通过守护进程列出静默
+func RemoteSilences(c AckConf) ([]Silence, error) {
+	var silences []Silence
+	err := silenceAPI(c, http.MethodGet, "", nil, &silences)
+	return silences, err
+}
+
+//silence命令通过守护进程创建临时静默
+func RemoteAddSilence(c AckConf, s Silence) (Silence, error) {
+	var created Silence
+	err := silenceAPI(c, http.MethodPost, "", silenceRequest{Silence: s}, &created)
+	return created, err
+}
+
+//silence命令通过守护进程提前结束临时静默
+func RemoteExpireSilence(c AckConf, id string) error {
+	return silenceAPI(c, http.MethodDelete, "?id="+url.QueryEscape(id), nil, nil)
+}
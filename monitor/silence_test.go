@@ -0,0 +1,188 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestCron(t *testing.T) {
+	at := func(s string) time.Time {
+		t, _ := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+		return t
+	}
+	//每周日02:00开始，持续2小时（2024-05-05为周日）
+	spec, err := parseCron("0 2 * * 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		now  string
+		want bool
+	}{
+		{"2024-05-05 01:59", false},
+		{"2024-05-05 02:00", true},
+		{"2024-05-05 03:59", true},
+		{"2024-05-05 04:00", false},
+		{"2024-05-06 02:30", false},
+	}
+	for _, c := range cases {
+		if got := spec.within(at(c.now), 2*time.Hour); got != c.want {
+			t.Errorf("within(%s) = %v, want %v", c.now, got, c.want)
+		}
+	}
+
+	spec, _ = parseCron("*/15 9-17 1,15 * 1-5")
+	if !spec.matches(at("2024-05-01 09:30")) || !spec.matches(at("2024-05-06 17:45")) || spec.matches(at("2024-05-04 10:00")) || spec.matches(at("2024-05-06 10:10")) {
+		t.Error("list, range and step fields mismatch")
+	}
+	if spec, _ = parseCron("0 0 * * 7"); !spec.matches(at("2024-05-05 00:00")) {
+		t.Error("7 should be sunday")
+	}
+	for _, expr := range []string{"0 2 * *", "60 2 * * *", "0 2 * * 8", "*/0 * * * *", "a * * * *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) should fail", expr)
+		}
+	}
+}
+
+func TestSilenceConf(t *testing.T) {
+	var conf Conf
+	err := yaml.Unmarshal([]byte(`
+silences:
+  - names: [MySQL]
+    start: "2024-05-01 02:00"
+    end: "2024-05-01 04:00"
+    comment: MySQL升级
+  - types: [mysql]
+    match:
+      env: prod
+    cron: "0 2 * * 0"
+    duration: 2h
+  - names: [Redis]
+`), &conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	silences := conf.silences()
+	s := silences[0]
+	if s.ID != "config-1" || s.Start.Format("2006-01-02 15:04") != "2024-05-01 02:00" || s.Start.Location() != time.Local {
+		t.Errorf("silence = %+v", s)
+	}
+	if !s.Active(s.Start.Add(time.Hour)) || s.Active(s.End) {
+		t.Error("fixed window mismatch")
+	}
+	db := Result{Name: "MySQL", Type: "mysql", Info: AlertInfo{Tags: map[string]string{"env": "prod"}}}
+	if !s.matches(db) || s.matches(Result{Name: "Redis", Type: "redis"}) || !silences[1].matches(db) {
+		t.Error("matchers mismatch")
+	}
+	if silences[1].Duration != 2*time.Hour || silences[1].validate() != nil {
+		t.Errorf("cron silence = %+v", silences[1])
+	}
+	if silences[2].validate() == nil {
+		t.Error("silence without end should fail")
+	}
+	if err = yaml.Unmarshal([]byte("silences:\n  - end: tomorrow\n"), &conf); err == nil {
+		t.Error("invalid time should fail")
+	}
+}
+
+func TestSilenceSuppress(t *testing.T) {
+	c := &fakeChecker{name: "MySQL", status: StatusFailed}
+	n := &recordNotifier{}
+	m := newAckMonitor(c, n)
+	s, err := m.AddSilence(Silence{Names: []string{"fake/MySQL"}, End: time.Now().Add(time.Hour), Comment: "升级", CreatedBy: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//临时静默单独保存，不写入检查状态
+	var stored []Silence
+	if ok, _ := m.tracker.store.GetData(silenceKey, &stored); !ok || len(stored) != 1 || stored[0].ID != s.ID {
+		t.Errorf("stored silences = %+v", stored)
+	}
+	//静默期间照常检查，但不发送通知
+	m.Check(context.Background(), c)
+	m.Flush()
+	if msgs := n.drain(); len(msgs) != 0 {
+		t.Fatalf("silenced messages = %+v", msgs)
+	}
+	if st, _ := m.tracker.State("fake", "MySQL"); st.State != StateFailing || !st.Silenced {
+		t.Errorf("state = %+v", st)
+	}
+	if summary := m.summary(ReportAlways); !strings.Contains(summary.Content, "（已静默）") {
+		t.Errorf("summary = %q", summary.Content)
+	}
+
+	//静默结束后仍故障时补发一次
+	if err = m.ExpireSilence(s.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.ExpireSilence(s.ID); err == nil {
+		t.Error("expire twice should fail")
+	}
+	m.Check(context.Background(), c)
+	m.Flush()
+	if msgs := n.drain(); len(msgs) != 1 || msgs[0].Event.Kind != EventRepeat {
+		t.Fatalf("messages after silence = %+v", msgs)
+	}
+	m.Check(context.Background(), c)
+	m.Flush()
+	if msgs := n.drain(); len(msgs) != 0 {
+		t.Errorf("messages after resend = %+v", msgs)
+	}
+
+	if _, err = m.AddSilence(Silence{Names: []string{"MySQL"}}); err == nil {
+		t.Error("silence without end should fail")
+	}
+}
+
+func TestSilencesHandler(t *testing.T) {
+	m := newAckMonitor(&fakeChecker{name: "MySQL"}, &recordNotifier{})
+	server := httptest.NewServer(http.HandlerFunc(m.silencesHandler))
+	defer server.Close()
+	do := func(method string, query string, body string, token string) *http.Response {
+		req, _ := http.NewRequest(method, server.URL+"/silences"+query, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp := do(http.MethodGet, "", "", "wrong"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("wrong token status = %d", resp.StatusCode)
+	}
+	resp := do(http.MethodPost, "", `{"names": ["MySQL"], "for": "2h", "comment": "升级", "created_by": "alice"}`, "s3cret")
+	var created Silence
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || created.ID == "" || created.End.Sub(created.Start) != 2*time.Hour {
+		t.Fatalf("create status = %d, silence = %+v", resp.StatusCode, created)
+	}
+	if resp = do(http.MethodPost, "", `{"names": ["MySQL"]}`, "s3cret"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("create without end status = %d", resp.StatusCode)
+	}
+
+	resp = do(http.MethodGet, "", "", "s3cret")
+	var silences []Silence
+	json.NewDecoder(resp.Body).Decode(&silences)
+	resp.Body.Close()
+	if len(silences) != 1 || silences[0].ID != created.ID || !silences[0].Active(time.Now()) {
+		t.Fatalf("list = %+v", silences)
+	}
+	if resp = do(http.MethodDelete, "?id="+created.ID, "", "s3cret"); resp.StatusCode != http.StatusOK {
+		t.Errorf("expire status = %d", resp.StatusCode)
+	}
+	if m.silenceOf(Result{Name: "MySQL", Type: "fake"}, time.Now()) != nil {
+		t.Error("expired silence still active")
+	}
+}
@@ -0,0 +1,345 @@
+// slack
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+var slackAPIServer = "https://slack.com/api"
+
+const (
+	//单条消息默认最大字节数，Mattermost单条消息限制约16000字符
+	DefaultSlackMaxBytes = 16000
+	//单次通知默认最多拆分的消息条数
+	DefaultSlackMaxMessages = 5
+	//每分钟默认最多发送条数，Slack限制每个频道每秒1条
+	DefaultSlackRateLimit = 60
+)
+
+func init() {
+	for _, flavor := range []string{"slack", "mattermost"} {
+		flavor := flavor
+		RegisterNotifier(flavor, func(nc NotifierConf) (Notifier, error) {
+			n := &SlackNotifier{name: nc.Name, flavor: flavor, client: nc.client(), templates: nc.Templates}
+			if err := nc.Decode(n); err != nil {
+				return nil, err
+			}
+			switch {
+			case n.WebhookUrl != "":
+			case n.Token == "":
+				return nil, fmt.Errorf("webhook_url or token is required")
+			case n.Channel == "":
+				return nil, fmt.Errorf("channel is required when using token")
+			case flavor == "mattermost" && n.Url == "":
+				return nil, fmt.Errorf("url is required when using token")
+			}
+			return n, nil
+		})
+	}
+}
+
+//Slack及Mattermost渠道：配置webhook_url时使用incoming webhook；配置token时通过API发送，
+//恢复消息回复到故障消息所在的会话
+type SlackNotifier struct {
+	name string
+	//slack或mattermost
+	flavor string
+	//发送请求使用的客户端，超时由delivery.timeout配置
+	client *http.Client
+	//消息文字使用的模板
+	templates *Templates
+	//incoming webhook地址
+	WebhookUrl string `yaml:"webhook_url"`
+	//API令牌：Slack为Bot Token，Mattermost为个人访问令牌或Bot令牌
+	Token string `yaml:"token"`
+	//API地址：Mattermost为服务器地址，Slack默认为https://slack.com/api
+	Url string `yaml:"url"`
+	//默认频道，实例可通过channel覆盖；使用token时Slack为频道名或ID，Mattermost为频道ID
+	Channel string `yaml:"channel"`
+	//webhook消息的显示名称及图标
+	Username  string `yaml:"username"`
+	IconEmoji string `yaml:"icon_emoji"`
+	//单次通知最多拆分条数及每分钟最多发送条数
+	MaxMessages int `yaml:"max_messages"`
+	RateLimit   int `yaml:"rate_limit"`
+	//记录故障消息所在的会话
+	store Store
+}
+
+//一条待发送的消息及其频道、回复的会话
+type slackPost struct {
+	channel string
+	thread  string
+}
+
+func (n *SlackNotifier) Name() string { return n.name }
+
+func (n *SlackNotifier) UseStore(store Store) { n.store = store }
+
+//发送消息，限流等待不可取消，见NotifyContext
+func (n *SlackNotifier) Notify(msgs []Message) error {
+	return n.NotifyContext(context.Background(), msgs)
+}
+
+//发送消息：按频道分组，同一故障的恢复消息回复到故障消息的会话，其余消息按级别排序后拆分发送
+func (n *SlackNotifier) NotifyContext(ctx context.Context, msgs []Message) error {
+	key := n.WebhookUrl
+	if key == "" {
+		key = n.Token
+	}
+	limiter := limiterOf(n.flavor+"/"+key, positive(n.RateLimit, DefaultSlackRateLimit), time.Minute)
+	maxChunks := positive(n.MaxMessages, DefaultSlackMaxMessages)
+	var chunks []msgChunk
+	var posts []slackPost
+	add := func(msgs []Message, p slackPost) {
+		size := func(c msgChunk) int { return n.size(c, p) }
+		for _, c := range splitChunks(n.templates, msgs, DefaultSlackMaxBytes, maxChunks, size) {
+			chunks = append(chunks, c)
+			posts = append(posts, p)
+		}
+	}
+	channels, byChannel := n.groupByChannel(sortBySeverity(msgs))
+	for _, channel := range channels {
+		var rest []Message
+		var threads []string
+		replies := map[string][]Message{}
+		for _, msg := range byChannel[channel] {
+			thread := n.thread(msg)
+			if thread == "" || msg.Severity() != "recovered" {
+				rest = append(rest, msg)
+				continue
+			}
+			if _, ok := replies[thread]; !ok {
+				threads = append(threads, thread)
+			}
+			replies[thread] = append(replies[thread], msg)
+		}
+		if len(rest) > 0 {
+			add(rest, slackPost{channel: channel})
+		}
+		for _, thread := range threads {
+			add(replies[thread], slackPost{channel: channel, thread: thread})
+		}
+	}
+	//sendChunks按顺序逐条发送，第i次调用对应posts[i]
+	sent := 0
+	return sendChunks(ctx, chunks, limiter, func(c msgChunk) error {
+		p := posts[sent]
+		thread, err := n.post(n.payload(c, p))
+		if err != nil {
+			return err
+		}
+		sent++
+		n.remember(c.msgs, thread, p.thread != "")
+		return nil
+	})
+}
+
+//按频道分组，保持频道首次出现的顺序
+func (n *SlackNotifier) groupByChannel(msgs []Message) ([]string, map[string][]Message) {
+	var channels []string
+	byChannel := map[string][]Message{}
+	for _, msg := range msgs {
+		channel := msg.Event.Result.Info.Channel
+		if channel == "" {
+			channel = n.Channel
+		}
+		if _, ok := byChannel[channel]; !ok {
+			channels = append(channels, channel)
+		}
+		byChannel[channel] = append(byChannel[channel], msg)
+	}
+	return channels, byChannel
+}
+
+//状态存储中记录故障消息所在会话的数据名称，内容为 类型/实例名 -> 会话
+func (n *SlackNotifier) threadsKey() string {
+	return n.flavor + "/" + n.name + "/threads"
+}
+
+//各实例当前故障消息所在的会话
+func (n *SlackNotifier) threads() map[string]string {
+	threads := map[string]string{}
+	if n.store == nil {
+		return threads
+	}
+	if _, err := n.store.GetData(n.threadsKey(), &threads); err != nil {
+		log.Errorf("Read %s threads error: %v", n.name, err)
+	}
+	return threads
+}
+
+//实例当前故障消息所在的会话，没有时为空
+func (n *SlackNotifier) thread(msg Message) string {
+	r := msg.Event.Result
+	if n.store == nil || r.Name == "" {
+		return ""
+	}
+	return n.threads()[stateKey(r.Type, r.Name)]
+}
+
+//记录故障消息所在的会话，恢复消息回复后清除；新的故障告警总是覆盖之前的会话，
+//以免上次故障的恢复消息未送达时（静默、路由或投递失败）沿用旧会话
+func (n *SlackNotifier) remember(msgs []Message, thread string, reply bool) {
+	if n.store == nil || thread == "" {
+		return
+	}
+	threads := n.threads()
+	changed := false
+	for _, msg := range msgs {
+		r := msg.Event.Result
+		if r.Name == "" {
+			continue
+		}
+		key := stateKey(r.Type, r.Name)
+		recovered := msg.Severity() == "recovered"
+		switch {
+		case reply && recovered:
+			delete(threads, key)
+			changed = true
+		case !reply && !recovered && (msg.Event.Kind == EventFailing || threads[key] == ""):
+			threads[key] = thread
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+	if err := n.store.PutData(n.threadsKey(), threads); err != nil {
+		log.Errorf("Save %s threads error: %v", n.name, err)
+	}
+}
+
+//消息体的字节数
+func (n *SlackNotifier) size(c msgChunk, p slackPost) int {
+	data, _ := json.Marshal(n.payload(c, p))
+	return len(data)
+}
+
+//消息体：标题及每条消息一个按级别着色的attachment，Slack与Mattermost格式相同，正文见line.slack、line.mattermost模板
+func (n *SlackNotifier) payload(c msgChunk, p slackPost) map[string]interface{} {
+	hostname, _ := os.Hostname()
+	var attachments []map[string]interface{}
+	for _, msg := range c.msgs {
+		r := msg.Event.Result
+		a := map[string]interface{}{
+			"color":    severityColors[msg.Severity()],
+			"fallback": msg.Title + " " + msg.Content,
+			"title":    msg.Title,
+			"text":     n.templates.lineText("line."+n.flavor, msg, false),
+			"footer":   hostname,
+		}
+		if r.Name != "" {
+			a["title"] = n.templates.instanceText(r.Name, r)
+			a["fields"] = []map[string]interface{}{
+				{"title": n.templates.labelText("target"), "value": r.Target, "short": true},
+				{"title": n.templates.labelText("severity"), "value": n.templates.severityLabel(msg.Severity()), "short": true},
+			}
+			if r.Info.Runbook != "" {
+				a["title_link"] = r.Info.Runbook
+			}
+		}
+		if !r.Time.IsZero() {
+			a["ts"] = r.Time.Unix()
+		}
+		attachments = append(attachments, a)
+	}
+	if len(c.overflow) > 0 {
+		attachments = append(attachments, map[string]interface{}{"text": n.templates.overflowText(c.overflow)})
+	}
+	text := n.templates.batchTitle(c)
+	if n.flavor == "mattermost" && n.WebhookUrl == "" {
+		post := map[string]interface{}{
+			"channel_id": p.channel,
+			"message":    text,
+			"props":      map[string]interface{}{"attachments": attachments},
+		}
+		if p.thread != "" {
+			post["root_id"] = p.thread
+		}
+		return post
+	}
+	payload := map[string]interface{}{"text": text, "attachments": attachments}
+	if p.channel != "" {
+		payload["channel"] = p.channel
+	}
+	if p.thread != "" {
+		//Slack会话记录为“频道ID 消息ts”
+		parts := strings.SplitN(p.thread, " ", 2)
+		if len(parts) == 2 {
+			payload["channel"], payload["thread_ts"] = parts[0], parts[1]
+		}
+	}
+	if n.WebhookUrl != "" {
+		if n.Username != "" {
+			payload["username"] = n.Username
+		}
+		if n.IconEmoji != "" {
+			payload["icon_emoji"] = n.IconEmoji
+		}
+	}
+	return payload
+}
+
+//发送一条消息，通过API发送时返回消息所在的会话
+func (n *SlackNotifier) post(payload map[string]interface{}) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	if n.WebhookUrl != "" {
+		_, err = httpPost(n.client, n.WebhookUrl, "application/json", string(data))
+		return "", err
+	}
+	url := slackAPIServer + "/chat.postMessage"
+	if n.flavor == "mattermost" {
+		url = strings.TrimRight(n.Url, "/") + "/api/v4/posts"
+	} else if n.Url != "" {
+		url = strings.TrimRight(n.Url, "/") + "/chat.postMessage"
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+n.Token)
+	body, err := httpDo(n.client, req)
+	if err != nil {
+		return "", err
+	}
+	if n.flavor == "mattermost" {
+		var resp struct {
+			Id string `json:"id"`
+		}
+		if err := json.Unmarshal(body, &resp); err != nil || resp.Id == "" {
+			return "", &DeliveryError{Err: fmt.Errorf("invalid mattermost response %q", body), Temporary: true}
+		}
+		return resp.Id, nil
+	}
+	var resp struct {
+		Ok      bool   `json:"ok"`
+		Error   string `json:"error"`
+		Channel string `json:"channel"`
+		Ts      string `json:"ts"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", &DeliveryError{Err: fmt.Errorf("invalid slack response %q: %v", body, err), Temporary: true}
+	}
+	if !resp.Ok {
+		return "", &DeliveryError{
+			Err:         fmt.Errorf("slack error: %s", resp.Error),
+			Temporary:   resp.Error == "internal_error" || resp.Error == "service_unavailable",
+			RateLimited: resp.Error == "ratelimited",
+		}
+	}
+	return resp.Channel + " " + resp.Ts, nil
+}
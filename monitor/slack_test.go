@@ -0,0 +1,172 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+//本地模拟的Slack API、Mattermost API及incoming webhook，记录收到的消息体
+type fakeSlack struct {
+	token    string
+	payloads []map[string]interface{}
+}
+
+func (f *fakeSlack) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var payload map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	switch r.URL.Path {
+	case "/webhook":
+		f.payloads = append(f.payloads, payload)
+		w.Write([]byte("ok"))
+	case "/chat.postMessage":
+		if r.Header.Get("Authorization") != "Bearer "+f.token {
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "invalid_auth"})
+			return
+		}
+		f.payloads = append(f.payloads, payload)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "channel": "C0001", "ts": fmt.Sprintf("1700000000.%06d", len(f.payloads))})
+	case "/api/v4/posts":
+		if r.Header.Get("Authorization") != "Bearer "+f.token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		f.payloads = append(f.payloads, payload)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": fmt.Sprintf("post%d", len(f.payloads))})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+//指向模拟服务的Slack或Mattermost渠道：配置了webhook_url时为webhook地址，否则为API地址；会话记录在内存存储中
+func newTestSlack(t *testing.T, typ string, fake *fakeSlack, options map[string]interface{}) (*SlackNotifier, func()) {
+	urlKey := "url"
+	if options["webhook_url"] != nil {
+		urlKey, options["webhook_url"] = "webhook_url", "/webhook"
+	}
+	n, stop := newTestNotifier(t, typ, fake, urlKey, options)
+	s := n.(*SlackNotifier)
+	s.UseStore(NewMemoryStore())
+	return s, stop
+}
+
+func TestSlackWebhook(t *testing.T) {
+	fake := &fakeSlack{}
+	n, stop := newTestSlack(t, "slack", fake, map[string]interface{}{"webhook_url": "", "channel": "#ops", "username": "monitor"})
+	defer stop()
+	msgs := testEventMsgs()
+	//实例覆盖频道
+	msgs[0].Event.Result.Info.Channel = "#cache"
+	if err := n.Notify(msgs); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.payloads) != 2 {
+		t.Fatalf("payloads = %v", fake.payloads)
+	}
+	ops, cache := fake.payloads[0], fake.payloads[1]
+	if ops["channel"] != "#ops" || cache["channel"] != "#cache" || ops["username"] != "monitor" {
+		t.Errorf("channels = %v, %v", ops["channel"], cache["channel"])
+	}
+	//按级别着色，严重在前
+	attachments := ops["attachments"].([]interface{})
+	colors := []interface{}{}
+	for _, a := range attachments {
+		colors = append(colors, a.(map[string]interface{})["color"])
+	}
+	if fmt.Sprint(colors) != fmt.Sprint([]string{severityColors[SeverityCritical], severityColors["recovered"]}) {
+		t.Errorf("colors = %v", colors)
+	}
+	if a := attachments[0].(map[string]interface{}); a["title_link"] != "https://wiki.example.com/nginx" {
+		t.Errorf("attachment = %v", a)
+	}
+}
+
+func TestSlackThreadReplies(t *testing.T) {
+	fake := &fakeSlack{token: "xoxb-1"}
+	n, stop := newTestSlack(t, "slack", fake, map[string]interface{}{"token": "xoxb-1", "channel": "#ops"})
+	defer stop()
+	down := testEventMsgs()[2]
+	if err := n.Notify([]Message{down}); err != nil {
+		t.Fatal(err)
+	}
+	//会话记录在渠道自己的数据中，不写入检查状态
+	r := down.Event.Result
+	var threads map[string]string
+	if ok, _ := n.store.GetData("slack/"+n.name+"/threads", &threads); !ok || threads[stateKey(r.Type, r.Name)] == "" {
+		t.Errorf("threads = %v", threads)
+	}
+	if _, ok := n.store.Get(stateKey(r.Type, r.Name)); ok {
+		t.Error("thread should not be stored as check state")
+	}
+	up := NewMessage(Event{Kind: EventRecovered, Result: down.Event.Result})
+	up.Event.Result.Status = StatusOK
+	if err := n.Notify([]Message{up}); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.payloads) != 2 {
+		t.Fatalf("payloads = %v", fake.payloads)
+	}
+	reply := fake.payloads[1]
+	if reply["thread_ts"] != "1700000000.000001" || reply["channel"] != "C0001" {
+		t.Errorf("reply = %v", reply)
+	}
+	//回复后清除会话，下次故障发送新消息
+	if n.thread(up) != "" {
+		t.Errorf("thread not cleared: %q", n.thread(up))
+	}
+	if err := n.Notify([]Message{down}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.payloads[2]["thread_ts"]; ok {
+		t.Errorf("new incident posted as reply: %v", fake.payloads[2])
+	}
+
+	//上次故障的恢复消息未发送到本渠道时，恢复消息回复到新故障的会话
+	fake = &fakeSlack{token: "xoxb-1"}
+	n, stop = newTestSlack(t, "slack", fake, map[string]interface{}{"token": "xoxb-1", "channel": "#ops"})
+	defer stop()
+	for _, msg := range []Message{down, down, up} {
+		if err := n.Notify([]Message{msg}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(fake.payloads) != 3 || fake.payloads[2]["thread_ts"] != "1700000000.000002" {
+		t.Errorf("payloads = %v", fake.payloads)
+	}
+}
+
+func TestMattermostThreadReplies(t *testing.T) {
+	fake := &fakeSlack{token: "mm-token"}
+	n, stop := newTestSlack(t, "mattermost", fake, map[string]interface{}{"token": "mm-token", "channel": "chan1"})
+	defer stop()
+	down := testEventMsgs()[2]
+	up := NewMessage(Event{Kind: EventRecovered, Result: down.Event.Result})
+	up.Event.Result.Status = StatusOK
+	for _, msg := range []Message{down, up} {
+		if err := n.Notify([]Message{msg}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(fake.payloads) != 2 || fake.payloads[0]["channel_id"] != "chan1" || fake.payloads[1]["root_id"] != "post1" {
+		t.Errorf("payloads = %v", fake.payloads)
+	}
+}
+
+func TestSlackConf(t *testing.T) {
+	for typ, options := range map[string]map[string]interface{}{
+		"slack":      {"token": "xoxb-1"},
+		"mattermost": {"token": "t", "channel": "c"},
+	} {
+		if _, err := NewNotifier(NotifierConf{Name: "s", Type: typ, Options: options}); err == nil {
+			t.Errorf("%s %v accepted", typ, options)
+		}
+	}
+	if _, err := NewNotifier(NotifierConf{Name: "s", Type: "slack"}); err == nil {
+		t.Error("slack without webhook_url or token accepted")
+	}
+}
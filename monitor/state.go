@@ -0,0 +1,309 @@
+// state
+package monitor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+//告警状态
+type AlertState int
+
+const (
+	StateOK AlertState = iota
+	StateFailing
+	StateRecovered
+)
+
+func (s AlertState) String() string {
+	switch s {
+	case StateFailing:
+		return "FAILING"
+	case StateRecovered:
+		return "RECOVERED"
+	default:
+		return "OK"
+	}
+}
+
+func (s AlertState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *AlertState) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "OK":
+		*s = StateOK
+	case "FAILING":
+		*s = StateFailing
+	case "RECOVERED":
+		*s = StateRecovered
+	default:
+		return fmt.Errorf("unknown alert state %q", text)
+	}
+	return nil
+}
+
+//单个检查的状态
+type CheckState struct {
+	Type  string     `json:"type"`
+	Name  string     `json:"name"`
+	State AlertState `json:"state"`
+	//最近一次检查结果及时间
+	LastStatus Status    `json:"last_status"`
+	LastCheck  time.Time `json:"last_check"`
+	//本次故障首次失败时间
+	FirstFailure time.Time `json:"first_failure"`
+	//连续失败及连续成功次数
+	ConsecutiveFailures  int `json:"consecutive_failures"`
+	ConsecutiveSuccesses int `json:"consecutive_successes"`
+	//最近一次通知时间
+	LastNotified time.Time `json:"last_notified"`
+	//最近的检查结果是否成功，用于抖动检测
+	History  []bool `json:"history,omitempty"`
+	Flapping bool   `json:"flapping"`
+	//本次故障已到达的升级步骤数
+	Escalated int `json:"escalated,omitempty"`
+	//本次故障的确认信息，确认后停止重复通知及升级
+	Ack *Ack `json:"ack,omitempty"`
+	//静默或上游故障期间有未单独发送的通知，静默结束或上游恢复后仍故障时补发
+	Silenced bool `json:"silenced,omitempty"`
+}
+
+//事件类型
+type EventKind int
+
+const (
+	//开始故障
+	EventFailing EventKind = iota
+	//故障持续，重复通知
+	EventRepeat
+	//故障恢复
+	EventRecovered
+	//开始抖动，之后暂停单独通知
+	EventFlapping
+	//抖动结束
+	EventStabilized
+	//运行汇总，见report_mode
+	EventSummary
+	//故障未确认，升级通知
+	EventEscalated
+	//故障已确认
+	EventAcked
+	//上游故障导致下游实例不可达，合并为一条通知
+	EventUnreachable
+)
+
+var eventKindNames = []string{"failing", "repeat", "recovered", "flapping", "stabilized", "summary", "escalated", "acked", "unreachable"}
+
+func (k EventKind) String() string {
+	if int(k) >= 0 && int(k) < len(eventKindNames) {
+		return eventKindNames[k]
+	}
+	return "unknown"
+}
+
+func (k EventKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *EventKind) UnmarshalText(text []byte) error {
+	for i, name := range eventKindNames {
+		if name == string(text) {
+			*k = EventKind(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown event kind %q", text)
+}
+
+//状态变化产生的通知事件
+type Event struct {
+	Kind   EventKind
+	Result Result
+	//连续失败次数
+	Failures int
+	//故障已持续时间
+	Downtime time.Duration
+	//最近结果中的状态变化百分比
+	FlapPercent float64
+	//已到达的升级步骤数，升级事件为本次到达的步骤序号（从1开始）
+	Escalation int
+	//故障的确认信息，未确认时为nil
+	Ack *Ack
+	//导致实例不可达的故障上游，发送前按上游合并
+	Parent *Result
+	//合并后的不可达下游实例
+	Children []string
+}
+
+//告警内容，由event.<kind>模板生成，使用默认语言
+func (e Event) Content() string {
+	return defaultTemplates.content(e)
+}
+
+//告警内容
+func (t *Templates) content(e Event) string {
+	if e.Kind == EventSummary {
+		return e.Result.Message
+	}
+	data := t.resultData(e.Result)
+	data.Failures = e.Failures
+	data.Downtime = humanDuration(e.Downtime)
+	data.FlapPercent = e.FlapPercent
+	data.Escalation = e.Escalation
+	data.Children = e.Children
+	if e.Ack != nil {
+		data.Acked = true
+		data.AckBy = e.Ack.By
+		data.AckComment = e.Ack.Comment
+	}
+	return t.render("event."+e.Kind.String(), data)
+}
+
+//状态跟踪：只在状态变化（及重复通知间隔到达）时产生事件，状态保存在Store中
+type Tracker struct {
+	lock  sync.Mutex
+	store Store
+}
+
+func NewTracker(store Store) *Tracker {
+	return &Tracker{store: store}
+}
+
+//检查的状态键
+func stateKey(typ string, name string) string {
+	return typ + "/" + name
+}
+
+//根据检查结果更新状态，需要通知时返回事件
+func (t *Tracker) Update(r Result, policy AlertPolicy) (Event, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	key := stateKey(r.Type, r.Name)
+	s, ok := t.store.Get(key)
+	if !ok {
+		s = CheckState{Type: r.Type, Name: r.Name}
+	}
+	e, notify := t.transition(&s, r, policy)
+	if policy.FlapWindow > 0 {
+		e, notify = t.flap(&s, r, policy, e, notify)
+	}
+	if notify && s.Ack != nil {
+		e.Ack = s.Ack
+	}
+	t.store.Put(key, s)
+	return e, notify
+}
+
+//抖动检测：进入和退出抖动时各通知一次，抖动期间屏蔽状态变化通知
+func (t *Tracker) flap(s *CheckState, r Result, policy AlertPolicy, e Event, notify bool) (Event, bool) {
+	s.History = append(s.History, r.OK())
+	if len(s.History) > policy.FlapWindow {
+		s.History = s.History[len(s.History)-policy.FlapWindow:]
+	}
+	//结果数不足窗口大小时不判断
+	if len(s.History) < policy.FlapWindow {
+		return e, notify
+	}
+	percent := flapPercent(s.History)
+	if !s.Flapping {
+		if percent < policy.FlapHighThreshold {
+			return e, notify
+		}
+		s.Flapping = true
+		s.LastNotified = s.LastCheck
+		return Event{Kind: EventFlapping, Result: r, FlapPercent: percent}, true
+	}
+	if percent >= policy.FlapLowThreshold {
+		return Event{}, false
+	}
+	s.Flapping = false
+	s.LastNotified = s.LastCheck
+	return Event{Kind: EventStabilized, Result: r, FlapPercent: percent}, true
+}
+
+//相邻结果状态变化次数占比（百分比）
+func flapPercent(history []bool) float64 {
+	if len(history) < 2 {
+		return 0
+	}
+	changes := 0
+	for i := 1; i < len(history); i++ {
+		if history[i] != history[i-1] {
+			changes++
+		}
+	}
+	return float64(changes) * 100 / float64(len(history)-1)
+}
+
+//状态流转
+func (t *Tracker) transition(s *CheckState, r Result, policy AlertPolicy) (Event, bool) {
+	now := r.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	s.LastStatus = r.Status
+	s.LastCheck = now
+
+	if r.OK() {
+		s.ConsecutiveFailures = 0
+		s.ConsecutiveSuccesses++
+		if s.State != StateFailing {
+			s.State = StateOK
+			s.FirstFailure = time.Time{}
+			return Event{}, false
+		}
+		//连续成功次数未达到恢复阈值时仍视为故障
+		if s.ConsecutiveSuccesses < policy.SuccessesBeforeRecovery {
+			return Event{}, false
+		}
+		e := Event{Kind: EventRecovered, Result: r, Downtime: now.Sub(s.FirstFailure)}
+		s.State = StateRecovered
+		s.FirstFailure = time.Time{}
+		s.LastNotified = now
+		return e, true
+	}
+
+	s.ConsecutiveSuccesses = 0
+	s.ConsecutiveFailures++
+	if s.FirstFailure.IsZero() {
+		s.FirstFailure = now
+	}
+	if s.State != StateFailing {
+		//连续失败次数未达到告警阈值时不通知
+		if s.ConsecutiveFailures < policy.FailuresBeforeAlert {
+			return Event{}, false
+		}
+		s.State = StateFailing
+		s.LastNotified = now
+		s.Escalated = 0
+		s.Ack = nil
+		return Event{Kind: EventFailing, Result: r, Failures: s.ConsecutiveFailures}, true
+	}
+	//已确认的故障不再重复通知
+	if policy.RepeatInterval > 0 && !s.acknowledged() && now.Sub(s.LastNotified) >= policy.RepeatInterval {
+		s.LastNotified = now
+		return Event{Kind: EventRepeat, Result: r, Failures: s.ConsecutiveFailures, Downtime: now.Sub(s.FirstFailure)}, true
+	}
+	return Event{}, false
+}
+
+//时长展示，如 12m、1h5m、30s
+func humanDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	h := d / time.Hour
+	m := (d % time.Hour) / time.Minute
+	s := (d % time.Minute) / time.Second
+	switch {
+	case h > 0 && m > 0:
+		return fmt.Sprintf("%dh%dm", h, m)
+	case h > 0:
+		return fmt.Sprintf("%dh", h)
+	case m > 0:
+		return fmt.Sprintf("%dm", m)
+	default:
+		return fmt.Sprintf("%ds", s)
+	}
+}
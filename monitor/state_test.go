@@ -0,0 +1,125 @@
+package monitor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+//一次检查：距开始的时间及是否成功
+type trackerStep struct {
+	offset time.Duration
+	ok     bool
+}
+
+//依次执行检查，返回每次的事件，不通知时为"-"
+func runTracker(policy AlertPolicy, steps []trackerStep) ([]string, []Event) {
+	tracker := NewTracker(NewMemoryStore())
+	start := time.Date(2024, 1, 1, 8, 0, 0, 0, time.Local)
+	var kinds []string
+	var events []Event
+	for _, step := range steps {
+		r := Result{Name: "MySQL", Type: "mysql", Status: StatusFailed, Time: start.Add(step.offset)}
+		if step.ok {
+			r.Status = StatusOK
+		}
+		e, ok := tracker.Update(r, policy)
+		if !ok {
+			kinds = append(kinds, "-")
+			continue
+		}
+		kinds = append(kinds, e.Kind.String())
+		events = append(events, e)
+	}
+	return kinds, events
+}
+
+func TestTrackerTransition(t *testing.T) {
+	policy := AlertPolicy{FailuresBeforeAlert: 1, SuccessesBeforeRecovery: 1}
+	for _, c := range []struct {
+		name   string
+		policy AlertPolicy
+		steps  []trackerStep
+		want   []string
+	}{
+		{"ok", policy, []trackerStep{{0, true}, {time.Minute, true}}, []string{"-", "-"}},
+		{"first failure", policy, []trackerStep{{0, true}, {time.Minute, false}}, []string{"-", "failing"}},
+		//持续故障只在首次通知，未配置重复间隔时不再通知
+		{"repeat disabled", policy, []trackerStep{{0, false}, {time.Minute, false}, {time.Hour, false}}, []string{"failing", "-", "-"}},
+		{"repeat", AlertPolicy{FailuresBeforeAlert: 1, SuccessesBeforeRecovery: 1, RepeatInterval: 30 * time.Minute},
+			[]trackerStep{{0, false}, {10 * time.Minute, false}, {30 * time.Minute, false}, {40 * time.Minute, false}, {60 * time.Minute, false}},
+			[]string{"failing", "-", "repeat", "-", "repeat"}},
+		{"recovery", policy, []trackerStep{{0, false}, {time.Minute, false}, {5 * time.Minute, true}, {6 * time.Minute, true}},
+			[]string{"failing", "-", "recovered", "-"}},
+		//再次故障重新告警
+		{"failure after recovery", policy, []trackerStep{{0, false}, {time.Minute, true}, {2 * time.Minute, false}},
+			[]string{"failing", "recovered", "failing"}},
+	} {
+		if got, _ := runTracker(c.policy, c.steps); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+//重复通知及恢复消息带上连续失败次数及故障持续时间
+func TestTrackerTransitionEvent(t *testing.T) {
+	policy := AlertPolicy{FailuresBeforeAlert: 1, SuccessesBeforeRecovery: 1, RepeatInterval: 30 * time.Minute}
+	_, events := runTracker(policy, []trackerStep{{0, false}, {10 * time.Minute, false}, {30 * time.Minute, false}, {45 * time.Minute, true}})
+	if len(events) != 3 {
+		t.Fatalf("events = %+v", events)
+	}
+	if e := events[0]; e.Kind != EventFailing || e.Failures != 1 {
+		t.Errorf("failing = %+v", e)
+	}
+	if e := events[1]; e.Kind != EventRepeat || e.Failures != 3 || e.Downtime != 30*time.Minute {
+		t.Errorf("repeat = %+v", e)
+	}
+	if e := events[2]; e.Kind != EventRecovered || e.Downtime != 45*time.Minute {
+		t.Errorf("recovered = %+v", e)
+	}
+}
+
+//按顺序生成检查结果，t为成功、f为失败，每次间隔1分钟
+func flapSteps(results string) []trackerStep {
+	var steps []trackerStep
+	for i, c := range results {
+		steps = append(steps, trackerStep{time.Duration(i) * time.Minute, c == 't'})
+	}
+	return steps
+}
+
+func TestTrackerFlap(t *testing.T) {
+	policy := AlertPolicy{FailuresBeforeAlert: 1, SuccessesBeforeRecovery: 1, FlapWindow: 5, FlapHighThreshold: 50, FlapLowThreshold: 25}
+	for _, c := range []struct {
+		name    string
+		results string
+		want    []string
+	}{
+		//结果数不足窗口大小时不判断抖动
+		{"window not full", "ftft", []string{"failing", "recovered", "failing", "recovered"}},
+		{"enter", "ftftf", []string{"failing", "recovered", "failing", "recovered", "flapping"}},
+		//变化比例25%低于进入阈值
+		{"below high threshold", "tttff", []string{"-", "-", "-", "failing", "-"}},
+		//变化比例恰好50%时进入抖动，屏蔽本次恢复通知
+		{"high threshold", "ttfft", []string{"-", "-", "failing", "-", "flapping"}},
+		//抖动期间不单独通知，变化比例降到25%仍视为抖动，低于25%时恢复稳定
+		{"stabilize", "ftftfffff", []string{"failing", "recovered", "failing", "recovered", "flapping", "-", "-", "-", "stabilized"}},
+		//恢复稳定后按状态正常通知
+		{"after stabilized", "ftftffffft", []string{"failing", "recovered", "failing", "recovered", "flapping", "-", "-", "-", "stabilized", "recovered"}},
+	} {
+		if got, _ := runTracker(policy, flapSteps(c.results)); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s = %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	//窗口外的结果不计入
+	_, events := runTracker(AlertPolicy{FailuresBeforeAlert: 1, SuccessesBeforeRecovery: 1, FlapWindow: 3, FlapHighThreshold: 50, FlapLowThreshold: 25}, flapSteps("tftfff"))
+	if last := events[len(events)-1]; last.Kind != EventStabilized || last.FlapPercent != 0 || last.Result.OK() {
+		t.Errorf("stabilized = %+v", last)
+	}
+	//未配置窗口时不检测
+	if got, _ := runTracker(AlertPolicy{FailuresBeforeAlert: 1, SuccessesBeforeRecovery: 1}, flapSteps("ftftft")); !reflect.DeepEqual(got,
+		[]string{"failing", "recovered", "failing", "recovered", "failing", "recovered"}) {
+		t.Errorf("disabled = %v", got)
+	}
+}
@@ -0,0 +1,176 @@
+// store
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+//默认状态文件
+const DefaultStateFile = "state.json"
+
+//状态存储配置
+type StateConf struct {
+	//存储类型：file（默认）或memory
+	Store string `yaml:"store"`
+	//file存储的文件路径
+	Path string `yaml:"path"`
+}
+
+//状态存储：检查状态的键为 类型/实例名；每日汇总时间、临时静默等其他数据按名称单独保存，不与检查状态混用
+type Store interface {
+	Get(key string) (CheckState, bool)
+	Put(key string, s CheckState)
+	//读取名为name的数据到v，不存在时返回false
+	GetData(name string, v interface{}) (bool, error)
+	//保存名为name的数据，v需可JSON序列化
+	PutData(name string, v interface{}) error
+	//持久化当前状态
+	Flush() error
+}
+
+//存储工厂
+type StoreFactory func(conf StateConf) (Store, error)
+
+var stores = map[string]StoreFactory{
+	"memory": func(conf StateConf) (Store, error) { return NewMemoryStore(), nil },
+	"file": func(conf StateConf) (Store, error) {
+		path := conf.Path
+		if path == "" {
+			path = DefaultStateFile
+		}
+		return NewFileStore(path)
+	},
+}
+
+//注册存储类型
+func RegisterStore(name string, factory StoreFactory) {
+	stores[name] = factory
+}
+
+//根据配置打开状态存储，未配置时使用file
+func OpenStore(conf StateConf) (Store, error) {
+	name := conf.Store
+	if name == "" {
+		name = "file"
+	}
+	factory, ok := stores[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown state store %q", name)
+	}
+	return factory(conf)
+}
+
+//内存存储，进程退出后状态丢失
+type MemoryStore struct {
+	lock   sync.RWMutex
+	states map[string]CheckState
+	data   map[string]json.RawMessage
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{states: map[string]CheckState{}, data: map[string]json.RawMessage{}}
+}
+
+func (m *MemoryStore) Get(key string) (CheckState, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	s, ok := m.states[key]
+	return s, ok
+}
+
+func (m *MemoryStore) Put(key string, s CheckState) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.states[key] = s
+}
+
+func (m *MemoryStore) GetData(name string, v interface{}) (bool, error) {
+	m.lock.RLock()
+	raw, ok := m.data[name]
+	m.lock.RUnlock()
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+func (m *MemoryStore) PutData(name string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.data[name] = raw
+	return nil
+}
+
+func (m *MemoryStore) Flush() error {
+	return nil
+}
+
+//JSON文件存储，打开时读入全部状态，Flush时整体写回
+type FileStore struct {
+	MemoryStore
+	path string
+}
+
+//状态文件内容
+type stateFile struct {
+	Checks map[string]CheckState      `json:"checks"`
+	Data   map[string]json.RawMessage `json:"data"`
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	f := &FileStore{MemoryStore: *NewMemoryStore(), path: path}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return f, nil
+	}
+	var file stateFile
+	if err = json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("read state file %s: %v", path, err)
+	}
+	if file.Checks != nil {
+		f.states = file.Checks
+	}
+	if file.Data != nil {
+		f.data = file.Data
+	}
+	return f, nil
+}
+
+//先写临时文件再重命名，避免中途退出损坏状态文件
+func (f *FileStore) Flush() error {
+	f.lock.RLock()
+	data, err := json.MarshalIndent(stateFile{Checks: f.states, Data: f.data}, "", "  ")
+	f.lock.RUnlock()
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
@@ -0,0 +1,122 @@
+package monitor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func tempStatePath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "state.json"), func() { os.RemoveAll(dir) }
+}
+
+func TestFileStore(t *testing.T) {
+	path, cleanup := tempStatePath(t)
+	defer cleanup()
+	//文件不存在时为空存储
+	f, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.Get("http/Web"); ok {
+		t.Error("new store should be empty")
+	}
+	now := time.Now().Round(time.Second)
+	want := CheckState{
+		Type: "http", Name: "Web", State: StateFailing, LastStatus: StatusTimeout, LastCheck: now,
+		FirstFailure: now.Add(-time.Minute), ConsecutiveFailures: 3, LastNotified: now, History: []bool{true, false},
+	}
+	f.Put("http/Web", want)
+	if err = f.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	//写回时不留下临时文件
+	files, _ := ioutil.ReadDir(filepath.Dir(path))
+	if len(files) != 1 {
+		t.Errorf("files after flush = %d, want 1", len(files))
+	}
+
+	f, err = NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := f.Get("http/Web")
+	if !ok || got.State != want.State || got.LastStatus != want.LastStatus || !got.LastCheck.Equal(want.LastCheck) ||
+		!got.FirstFailure.Equal(want.FirstFailure) || got.ConsecutiveFailures != 3 || len(got.History) != 2 {
+		t.Errorf("reloaded state = %+v, want %+v", got, want)
+	}
+
+	//空文件视为空存储，损坏的文件报错
+	ioutil.WriteFile(path, nil, 0644)
+	if _, err = NewFileStore(path); err != nil {
+		t.Errorf("empty file: %v", err)
+	}
+	ioutil.WriteFile(path, []byte("{broken"), 0644)
+	if _, err = NewFileStore(path); err == nil {
+		t.Error("broken file should fail")
+	}
+}
+
+//重启后从状态文件继续：不重复发送故障告警，恢复时按首次失败时间计算故障时长
+func TestFileStoreRestart(t *testing.T) {
+	path, cleanup := tempStatePath(t)
+	defer cleanup()
+	policy := (&Conf{}).PolicyOf(PolicyConf{})
+	start := time.Now()
+	r := Result{Name: "Redis", Type: "redis", Status: StatusFailed, Time: start}
+
+	f, _ := NewFileStore(path)
+	if e, ok := NewTracker(f).Update(r, policy); !ok || e.Kind != EventFailing {
+		t.Fatalf("first failure = %v, %v", e.Kind, ok)
+	}
+	if err := f.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, _ = NewFileStore(path)
+	tracker := NewTracker(f)
+	r.Time = start.Add(time.Minute)
+	if e, ok := tracker.Update(r, policy); ok {
+		t.Errorf("failure after restart notified again: %v", e.Kind)
+	}
+	r.Status, r.Time = StatusOK, start.Add(10*time.Minute)
+	e, ok := tracker.Update(r, policy)
+	if !ok || e.Kind != EventRecovered || e.Downtime != 10*time.Minute {
+		t.Errorf("recovery after restart = %v, %v, downtime %v", e.Kind, ok, e.Downtime)
+	}
+}
+
+func TestFileStoreData(t *testing.T) {
+	path, cleanup := tempStatePath(t)
+	defer cleanup()
+	f, _ := NewFileStore(path)
+	now := time.Now().Round(time.Second)
+	if err := f.PutData(digestKey, digestState{LastSent: now}); err != nil {
+		t.Fatal(err)
+	}
+	f.Put("http/Web", CheckState{Type: "http", Name: "Web", State: StateFailing})
+	if err := f.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var digest digestState
+	if ok, err := f.GetData(digestKey, &digest); !ok || err != nil || !digest.LastSent.Equal(now) {
+		t.Errorf("digest = %v, %v, %v", digest, ok, err)
+	}
+	//数据与检查状态互不影响
+	if _, ok := f.Get(digestKey); ok {
+		t.Error("data should not be visible as check state")
+	}
+	if ok, _ := f.GetData("http/Web", &digest); ok {
+		t.Error("check state should not be visible as data")
+	}
+}
@@ -0,0 +1,52 @@
+// tcp
+package monitor
+
+import (
+	"context"
+	"net"
+)
+
+func init() {
+	Register("tcp", "TCP", func(conf *Conf) []Checker {
+		var checkers []Checker
+		for _, inst := range conf.Instances.TCP {
+			checkers = append(checkers, NewTCPChecker(conf, inst))
+		}
+		return checkers
+	})
+}
+
+//TCP检查器
+type TCPChecker struct {
+	base
+	inst TCPInstance
+}
+
+func NewTCPChecker(conf *Conf, inst TCPInstance) *TCPChecker {
+	return &TCPChecker{
+		base: base{
+			name:     inst.Name,
+			target:   net.JoinHostPort(inst.Host, inst.Port),
+			interval: conf.IntervalOf(inst.Interval),
+			timeout:  conf.TimeoutOf(inst.Timeout),
+			policy:   conf.PolicyOf(inst.PolicyConf),
+			info:     inst.AlertInfo.withDefaults(),
+		},
+		inst: inst,
+	}
+}
+
+func (c *TCPChecker) Type() string { return "tcp" }
+
+//建立TCP连接
+func (c *TCPChecker) Check(ctx context.Context) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout.Total)
+	defer cancel()
+	dialer := &net.Dialer{Timeout: c.timeout.Connect}
+	conn, err := dialer.DialContext(ctx, "tcp", c.target)
+	if err != nil {
+		return c.fail(c.Type(), "connect", err)
+	}
+	conn.Close()
+	return c.ok(c.Type())
+}
@@ -0,0 +1,373 @@
+// templates
+package monitor
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+//默认语言
+const DefaultLanguage = "zh-CN"
+
+//各渠道中一条消息占一行的排版，与语言无关，语言模板及自定义模板可覆盖：
+//line.dingtalk、line.wecom、line.feishu为markdown行，line.feishu_post为飞书富文本行中的文字（链接以line.separator分隔附加在后），
+//line.slack、line.mattermost为附件正文
+var builtinLayouts = `
+{{define "line.dingtalk"}}- {{if .Name}}{{.Instance}}｜ {{code .Target}} ｜ {{.Content}}{{template "line.links" .}}{{else}}**{{.Title}}** ｜ {{.Content}}{{end}}{{end}}
+{{define "line.wecom"}}> {{if .Name}}{{.Instance}}｜ {{code .Target}} ｜ {{.Content}}{{template "line.links" .}}{{else}}**{{.Title}}** ｜ {{.Content}}{{end}}{{end}}
+{{define "line.feishu"}}- {{if .Name}}{{.Instance}}｜ {{.Target}} ｜ {{.Content}}{{template "line.links" .}}{{else}}**{{.Title}}** ｜ {{.Content}}{{end}}{{end}}
+{{define "line.links"}}{{if .Runbook}} ｜ [{{template "label.runbook"}}]({{.Runbook}}){{end}}{{if .AckURL}} ｜ [{{template "label.ack"}}]({{.AckURL}}){{end}}{{end}}
+{{define "line.feishu_post"}}{{if .Name}}{{.Instance}}｜ {{.Target}} ｜ {{.Content}}{{else}}{{.Title}} ｜ {{.Content}}{{end}}{{end}}
+{{define "line.separator"}} ｜ {{end}}
+{{define "line.slack"}}{{.Content}}{{if .AckURL}}
+<{{.AckURL}}|{{template "label.ack"}}>{{end}}{{end}}
+{{define "line.mattermost"}}{{.Content}}{{if .AckURL}}
+[{{template "label.ack"}}]({{.AckURL}}){{end}}{{end}}
+`
+
+//内置模板集：check.*为检查结果，event.*为告警内容，title为告警标题，
+//severity.*为级别名称，batch.*及label.*为各渠道消息中的文字（每行的排版见builtinLayouts），summary.*为运行汇总，email.*为邮件正文，
+//ack.*为确认链接打开的页面，test.*为test-notify命令发送的测试消息
+var builtinTemplates = map[string]string{
+	"zh-CN": `
+{{define "title"}}{{.TypeLabel}} -> {{.Name}}【{{.Target}}】{{end}}
+{{define "attempts"}}{{if or (gt .Attempts 1) (gt .Failures 1)}}（{{if gt .Attempts 1}}尝试{{.Attempts}}次{{if gt .Failures 1}}，{{end}}{{end}}{{if gt .Failures 1}}连续失败{{.Failures}}次{{end}}）{{end}}{{end}}
+{{define "check.ok"}}运行正常{{end}}
+{{define "check.error"}}{{.Error}}{{end}}
+{{define "check.request"}}请求异常{{end}}
+{{define "check.status"}}状态码异常: {{.Error}}{{end}}
+{{define "check.mismatch"}}响应内容不匹配{{end}}
+{{define "check.connect"}}连接异常{{end}}
+{{define "check.query"}}查询测试失败，请检查服务{{end}}
+{{define "check.timeout"}}检查超时: {{.Error}}{{end}}
+{{define "check.refused"}}连接被拒绝{{end}}
+{{define "check.unreachable"}}主机不可达: {{.Error}}{{end}}
+{{define "event.failing"}}{{.Error}}{{template "attempts" .}}{{end}}
+{{define "ack"}}{{if .Acked}}（{{.AckBy}}已确认{{if .AckComment}}: {{.AckComment}}{{end}}）{{end}}{{end}}
+{{define "event.repeat"}}仍未恢复，已持续{{.Downtime}}: {{.Error}}{{template "attempts" .}}{{template "ack" .}}{{end}}
+{{define "event.recovered"}}已恢复，故障持续{{.Downtime}}{{template "ack" .}}{{end}}
+{{define "event.acked"}}{{.AckBy}}已确认故障{{if .AckComment}}: {{.AckComment}}{{end}}，停止重复通知及升级{{end}}
+{{define "event.escalated"}}已持续{{.Downtime}}未确认，升级至第{{.Escalation}}级: {{.Error}}{{template "attempts" .}}{{end}}
+{{define "event.flapping"}}状态频繁变化（变化率{{printf "%.0f" .FlapPercent}}%），暂停单独通知直至稳定{{template "ack" .}}{{end}}
+{{define "event.unreachable"}}故障导致{{len .Children}}个依赖实例不可达，不再单独告警: {{range $i, $c := .Children}}{{if $i}}、{{end}}{{$c}}{{end}}{{end}}
+{{define "event.stabilized"}}已停止频繁变化（变化率{{printf "%.0f" .FlapPercent}}%），{{if .OK}}当前状态正常{{else}}当前仍故障: {{.Error}}{{end}}{{template "ack" .}}{{end}}
+{{define "severity.critical"}}严重{{end}}
+{{define "severity.warning"}}警告{{end}}
+{{define "severity.info"}}提示{{end}}
+{{define "severity.recovered"}}已恢复{{end}}
+{{define "batch.title"}}服务监控{{.Part}}：{{range $i, $c := .Counts}}{{if $i}} {{end}}{{$c.Label}}{{$c.Count}}{{end}}{{end}}
+{{define "batch.part"}}（{{.Index}}/{{.Total}}）{{end}}
+{{define "batch.group"}}{{.Label}}（{{.Count}}）{{end}}
+{{define "batch.instance"}}{{.Name}}（{{.Type}}）{{end}}
+{{define "batch.overflow"}}还有{{if .Failures}}{{.Failures}}个故障{{if .Others}}、{{end}}{{end}}{{if .Others}}{{.Others}}条{{if .Failures}}其他{{end}}消息{{end}}未展示{{end}}
+{{define "batch.truncated"}}…（内容过长已截断）{{end}}
+{{define "batch.mention"}}服务监控告警，请及时处理{{end}}
+{{define "label.runbook"}}处理手册{{end}}
+{{define "label.target"}}目标{{end}}
+{{define "label.severity"}}级别{{end}}
+{{define "label.all"}}所有人{{end}}
+{{define "label.ack"}}确认{{end}}
+{{define "label.silenced"}}（已静默）{{end}}
+{{define "ack.form"}}<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width"><title>确认故障</title></head><body>
+<h3>{{html .Title}}</h3>
+<p>{{html .Error}}{{if .Downtime}}（已持续{{.Downtime}}）{{end}}</p>
+<form method="post">
+<p>确认人 <input name="by"></p>
+<p>备注 <input name="comment" size="40"></p>
+<p><button type="submit">确认故障</button></p>
+</form>
+</body></html>
+{{end}}
+{{define "ack.done"}}<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width"><title>确认故障</title></head><body>
+<h3>{{html .Title}}</h3>
+<p>{{if .Error}}确认失败: {{html .Error}}{{else}}已确认，停止重复通知及升级{{end}}</p>
+</body></html>
+{{end}}
+{{define "test.title"}}服务监控 -> {{.Hostname}}{{end}}
+{{define "test.content"}}测试消息，收到说明通知渠道配置正确{{end}}
+{{define "summary.title"}}{{if eq .Mode "digest"}}每日健康报告{{else}}运行报告{{end}} -> {{.Hostname}}{{end}}
+{{define "summary.content"}}{{if .Failures}}{{.Total}}个检查中{{len .Failures}}个异常{{else}}全部{{.Total}}个检查正常{{end}}
+{{range $i, $c := .Counts}}{{if $i}}，{{end}}{{$c.TypeLabel}} {{$c.Total}}{{if $c.Failed}}（异常{{$c.Failed}}）{{end}}{{end}}{{range .Failures}}
+{{.}}{{end}}{{end}}
+{{define "email.text"}}{{.Title}}
+
+{{range .Rows}}[{{.Severity}}] {{.Name}}{{if .Type}}（{{.Type}}）{{end}}{{if .Target}} {{.Target}}{{end}}
+  {{indent "  " .Message}}
+{{if .Duration}}  耗时: {{.Duration}}
+{{end}}{{if .Runbook}}  处理手册: {{.Runbook}}
+{{end}}{{end}}
+{{.Hostname}}
+{{end}}
+{{define "email.html"}}<html><body>
+<h3>{{html .Title}}</h3>
+<table border="1" cellspacing="0" cellpadding="4" style="border-collapse:collapse">
+<tr><th>级别</th><th>实例</th><th>类型</th><th>目标</th><th>信息</th><th>耗时</th></tr>
+{{range .Rows}}<tr><td style="color:{{.Color}}">{{html .Severity}}</td><td>{{html .Name}}</td><td>{{html .Type}}</td><td>{{html .Target}}</td><td>{{html .Message}}{{if .Runbook}} <a href="{{html .Runbook}}">处理手册</a>{{end}}</td><td>{{.Duration}}</td></tr>
+{{end}}</table>
+<p style="color:#888">{{html .Hostname}}</p>
+</body></html>
+{{end}}
+`,
+	"en-US": `
+{{define "title"}}{{.TypeLabel}} -> {{.Name}} [{{.Target}}]{{end}}
+{{define "attempts"}}{{if or (gt .Attempts 1) (gt .Failures 1)}} ({{if gt .Attempts 1}}{{.Attempts}} attempts{{if gt .Failures 1}}, {{end}}{{end}}{{if gt .Failures 1}}{{.Failures}} consecutive failures{{end}}){{end}}{{end}}
+{{define "check.ok"}}is running{{end}}
+{{define "check.error"}}{{.Error}}{{end}}
+{{define "check.request"}}Request failed{{end}}
+{{define "check.status"}}Unexpected status: {{.Error}}{{end}}
+{{define "check.mismatch"}}Response does not match content_match{{end}}
+{{define "check.connect"}}Connection failed{{end}}
+{{define "check.query"}}Test query failed, please check the service{{end}}
+{{define "check.timeout"}}Check timed out: {{.Error}}{{end}}
+{{define "check.refused"}}Connection refused{{end}}
+{{define "check.unreachable"}}Host unreachable: {{.Error}}{{end}}
+{{define "event.failing"}}{{.Error}}{{template "attempts" .}}{{end}}
+{{define "ack"}}{{if .Acked}} (acknowledged by {{.AckBy}}{{if .AckComment}}: {{.AckComment}}{{end}}){{end}}{{end}}
+{{define "event.repeat"}}Still down after {{.Downtime}}: {{.Error}}{{template "attempts" .}}{{template "ack" .}}{{end}}
+{{define "event.recovered"}}Recovered after {{.Downtime}} of downtime{{template "ack" .}}{{end}}
+{{define "event.acked"}}Acknowledged by {{.AckBy}}{{if .AckComment}}: {{.AckComment}}{{end}}, repeat notifications and escalation stopped{{end}}
+{{define "event.escalated"}}Unacknowledged for {{.Downtime}}, escalated to level {{.Escalation}}: {{.Error}}{{template "attempts" .}}{{end}}
+{{define "event.flapping"}}Flapping ({{printf "%.0f" .FlapPercent}}% state changes), notifications paused until stable{{template "ack" .}}{{end}}
+{{define "event.unreachable"}}{{len .Children}} dependent instance(s) unreachable due to this failure, not alerted separately: {{range $i, $c := .Children}}{{if $i}}, {{end}}{{$c}}{{end}}{{end}}
+{{define "event.stabilized"}}Stopped flapping ({{printf "%.0f" .FlapPercent}}% state changes), {{if .OK}}currently OK{{else}}still down: {{.Error}}{{end}}{{template "ack" .}}{{end}}
+{{define "severity.critical"}}Critical{{end}}
+{{define "severity.warning"}}Warning{{end}}
+{{define "severity.info"}}Info{{end}}
+{{define "severity.recovered"}}Recovered{{end}}
+{{define "batch.title"}}ServerMonitor{{.Part}}: {{range $i, $c := .Counts}}{{if $i}}, {{end}}{{$c.Count}} {{$c.Label}}{{end}}{{end}}
+{{define "batch.part"}} ({{.Index}}/{{.Total}}){{end}}
+{{define "batch.group"}}{{.Label}} ({{.Count}}){{end}}
+{{define "batch.instance"}}{{.Name}} ({{.Type}}){{end}}
+{{define "batch.overflow"}}{{if .Failures}}{{.Failures}} more failures{{if .Others}} and {{end}}{{end}}{{if .Others}}{{.Others}} more messages{{end}} not shown{{end}}
+{{define "batch.truncated"}}… (truncated){{end}}
+{{define "batch.mention"}}ServerMonitor alert, please check{{end}}
+{{define "label.runbook"}}Runbook{{end}}
+{{define "label.target"}}Target{{end}}
+{{define "label.severity"}}Severity{{end}}
+{{define "label.all"}}all{{end}}
+{{define "label.ack"}}Acknowledge{{end}}
+{{define "label.silenced"}} (silenced){{end}}
+{{define "ack.form"}}<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width"><title>Acknowledge</title></head><body>
+<h3>{{html .Title}}</h3>
+<p>{{html .Error}}{{if .Downtime}} (down for {{.Downtime}}){{end}}</p>
+<form method="post">
+<p>Name <input name="by"></p>
+<p>Comment <input name="comment" size="40"></p>
+<p><button type="submit">Acknowledge</button></p>
+</form>
+</body></html>
+{{end}}
+{{define "ack.done"}}<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width"><title>Acknowledge</title></head><body>
+<h3>{{html .Title}}</h3>
+<p>{{if .Error}}Acknowledge failed: {{html .Error}}{{else}}Acknowledged, repeat notifications and escalation stopped{{end}}</p>
+</body></html>
+{{end}}
+{{define "test.title"}}ServerMonitor -> {{.Hostname}}{{end}}
+{{define "test.content"}}Test message, the notifier is configured correctly{{end}}
+{{define "summary.title"}}{{if eq .Mode "digest"}}Daily health report{{else}}Run report{{end}} -> {{.Hostname}}{{end}}
+{{define "summary.content"}}{{if .Failures}}{{len .Failures}} of {{.Total}} checks failing{{else}}All {{.Total}} checks OK{{end}}
+{{range $i, $c := .Counts}}{{if $i}}, {{end}}{{$c.TypeLabel}} {{$c.Total}}{{if $c.Failed}} ({{$c.Failed}} failing){{end}}{{end}}{{range .Failures}}
+{{.}}{{end}}{{end}}
+{{define "email.text"}}{{.Title}}
+
+{{range .Rows}}[{{.Severity}}] {{.Name}}{{if .Type}} ({{.Type}}){{end}}{{if .Target}} {{.Target}}{{end}}
+  {{indent "  " .Message}}
+{{if .Duration}}  Duration: {{.Duration}}
+{{end}}{{if .Runbook}}  Runbook: {{.Runbook}}
+{{end}}{{end}}
+{{.Hostname}}
+{{end}}
+{{define "email.html"}}<html><body>
+<h3>{{html .Title}}</h3>
+<table border="1" cellspacing="0" cellpadding="4" style="border-collapse:collapse">
+<tr><th>Severity</th><th>Instance</th><th>Type</th><th>Target</th><th>Message</th><th>Duration</th></tr>
+{{range .Rows}}<tr><td style="color:{{.Color}}">{{html .Severity}}</td><td>{{html .Name}}</td><td>{{html .Type}}</td><td>{{html .Target}}</td><td>{{html .Message}}{{if .Runbook}} <a href="{{html .Runbook}}">Runbook</a>{{end}}</td><td>{{.Duration}}</td></tr>
+{{end}}</table>
+<p style="color:#888">{{html .Hostname}}</p>
+</body></html>
+{{end}}
+`,
+}
+
+//模板中可用的函数
+var templateFuncs = template.FuncMap{
+	//多行文字除第一行外加缩进
+	"indent": func(prefix string, s string) string {
+		return strings.Replace(s, "\n", "\n"+prefix, -1)
+	},
+	//markdown行内代码
+	"code": func(s string) string {
+		return "`" + s + "`"
+	},
+}
+
+//一组已加载的模板：Monitor按language及templates配置加载后传给通知渠道，各Monitor互不影响；
+//为nil时使用默认语言的内置模板
+type Templates struct {
+	t *template.Template
+}
+
+//默认语言的内置模板，用于不属于某个Monitor的场景，如单独创建的通知渠道
+var defaultTemplates = mustTemplates(DefaultLanguage)
+
+//告警标题及内容模板中可用的字段
+type TemplateData struct {
+	//实例名、类型（如http）、类型名称（如HTTP）及检查目标
+	Name      string
+	Type      string
+	TypeLabel string
+	Target    string
+	//检查结果信息，如“连接被拒绝”
+	Error string
+	//检查耗时及故障持续时间
+	Duration string
+	Downtime string
+	//运行监控的主机名
+	Hostname string
+	//级别名称及处理手册
+	Severity string
+	Runbook  string
+	//尝试次数、连续失败次数及抖动变化率
+	Attempts    int
+	Failures    int
+	FlapPercent float64
+	//升级步骤序号
+	Escalation int
+	//是否已确认，及确认人、备注
+	Acked      bool
+	AckBy      string
+	AckComment string
+	//因本实例故障而不可达的下游实例
+	Children []string
+	//当前检查是否通过
+	OK bool
+}
+
+//消息行模板中可用的字段，见line.*模板
+type LineData struct {
+	//消息标题及内容
+	Title   string
+	Content string
+	//实例名，手动构造的消息为空；Instance为batch.instance生成的带类型名称，markdown渠道中实例名加粗
+	Name     string
+	Instance string
+	Target   string
+	//处理手册及确认链接
+	Runbook string
+	AckURL  string
+}
+
+//支持的语言
+func Languages() []string {
+	var languages []string
+	for language := range builtinTemplates {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+//加载语言的内置模板，dir不为空时用其中的*.tmpl覆盖，文件名（不含扩展名）为模板名，如event.failing.tmpl
+func LoadTemplates(language string, dir string) (*Templates, error) {
+	if language == "" {
+		language = DefaultLanguage
+	}
+	src, ok := builtinTemplates[language]
+	if !ok {
+		return nil, fmt.Errorf("unknown language %q, supported: %s", language, strings.Join(Languages(), ", "))
+	}
+	t, err := template.New(language).Funcs(templateFuncs).Parse(builtinLayouts)
+	if err == nil {
+		_, err = t.Parse(src)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		return &Templates{t}, nil
+	}
+	if _, err = os.Stat(dir); err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimSuffix(filepath.Base(file), ".tmpl")
+		if _, err = t.New(name).Parse(string(data)); err != nil {
+			return nil, err
+		}
+	}
+	return &Templates{t}, nil
+}
+
+func mustTemplates(language string) *Templates {
+	t, err := LoadTemplates(language, "")
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+//实际使用的模板
+func (t *Templates) tmpl() *template.Template {
+	if t == nil {
+		return defaultTemplates.t
+	}
+	return t.t
+}
+
+//按名称渲染模板，出错时记录日志并返回模板名
+func (t *Templates) render(name string, data interface{}) string {
+	var b strings.Builder
+	if err := t.execute(&b, name, data); err != nil {
+		log.Errorf("Render template %s error: %v", name, err)
+		return name
+	}
+	return b.String()
+}
+
+//按名称渲染模板到w
+func (t *Templates) execute(w io.Writer, name string, data interface{}) error {
+	return t.tmpl().ExecuteTemplate(w, name, data)
+}
+
+//是否有名为name的模板
+func (t *Templates) has(name string) bool {
+	return t.tmpl().Lookup(name) != nil
+}
+
+//检查结果对应的模板数据
+func (t *Templates) resultData(r Result) TemplateData {
+	hostname, _ := os.Hostname()
+	data := TemplateData{
+		Name:      r.Name,
+		Type:      r.Type,
+		TypeLabel: TypeLabel(r.Type),
+		Target:    r.Target,
+		Error:     r.Message,
+		Hostname:  hostname,
+		Severity:  t.severityLabel(r.Info.withDefaults().Severity),
+		Runbook:   r.Info.Runbook,
+		Attempts:  r.Attempts,
+		OK:        r.OK(),
+	}
+	if r.Duration > 0 {
+		data.Duration = r.Duration.Round(time.Millisecond).String()
+	}
+	return data
+}
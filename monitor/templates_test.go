@@ -0,0 +1,127 @@
+package monitor
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+//加载模板，出错时结束测试
+func loadTemplatesForTest(t *testing.T, language string, dir string) *Templates {
+	tmpl, err := LoadTemplates(language, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tmpl
+}
+
+func TestTemplatesLanguage(t *testing.T) {
+	r := Result{Name: "Nginx", Type: "http", Target: "http://192.168.1.100:80", Status: StatusFailed, Message: "connection refused", Attempts: 1}
+	e := Event{Kind: EventRecovered, Result: r, Downtime: 12 * time.Minute}
+
+	if got, want := r.Title(), "HTTP -> Nginx【http://192.168.1.100:80】"; got != want {
+		t.Errorf("zh-CN title = %q, want %q", got, want)
+	}
+	if got, want := e.Content(), "已恢复，故障持续12m"; got != want {
+		t.Errorf("zh-CN content = %q, want %q", got, want)
+	}
+
+	en := loadTemplatesForTest(t, "en-US", "")
+	if got, want := en.title(r), "HTTP -> Nginx [http://192.168.1.100:80]"; got != want {
+		t.Errorf("en-US title = %q, want %q", got, want)
+	}
+	if got, want := en.content(e), "Recovered after 12m of downtime"; got != want {
+		t.Errorf("en-US content = %q, want %q", got, want)
+	}
+	if got := en.TestMessage("web01"); got.Title != "ServerMonitor -> web01" || !strings.HasPrefix(got.Content, "Test message") {
+		t.Errorf("en-US test message = %+v", got)
+	}
+
+	if _, err := LoadTemplates("fr-FR", ""); err == nil {
+		t.Error("unknown language should fail")
+	}
+}
+
+func TestTemplatesOverride(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := "[{{.Severity}}] {{.Name}} on {{.Hostname}}: {{.Error}}"
+	if err = ioutil.WriteFile(filepath.Join(dir, "event.failing.tmpl"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := loadTemplatesForTest(t, "en-US", dir)
+	hostname, _ := os.Hostname()
+	r := Result{Name: "Redis", Type: "redis", Target: "192.168.10.100:6379", Status: StatusFailed, Message: "connection refused", Attempts: 1}
+	if got, want := tmpl.content(Event{Kind: EventFailing, Result: r, Failures: 1}), "[Critical] Redis on "+hostname+": connection refused"; got != want {
+		t.Errorf("overridden content = %q, want %q", got, want)
+	}
+	//未覆盖的模板仍使用所选语言
+	if got, want := tmpl.content(Event{Kind: EventRecovered, Result: r, Downtime: time.Minute}), "Recovered after 1m of downtime"; got != want {
+		t.Errorf("builtin content = %q, want %q", got, want)
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(dir, "title.tmpl"), []byte("{{.Name"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadTemplates("en-US", dir); err == nil {
+		t.Error("invalid template should fail")
+	}
+}
+
+//各Monitor使用各自配置的语言，互不影响
+func TestTemplatesPerMonitor(t *testing.T) {
+	newMonitor := func(language string) *Monitor {
+		conf := &Conf{Language: language, State: StateConf{Store: "memory"}}
+		conf.Instances.TCP = []TCPInstance{{Name: "Dead", Host: "127.0.0.1", Port: "1"}}
+		return New(conf)
+	}
+	zh, en := newMonitor("zh-CN"), newMonitor("en-US")
+	for _, c := range []struct {
+		m       *Monitor
+		title   string
+		content string
+	}{
+		{zh, "TCP -> Dead【127.0.0.1:1】", "连接被拒绝"},
+		{en, "TCP -> Dead [127.0.0.1:1]", "Connection refused"},
+	} {
+		c.m.Check(context.Background(), c.m.Checkers[0])
+		msgs := c.m.msgs.Drain()
+		if len(msgs) != 1 || msgs[0].Title != c.title || msgs[0].Content != c.content {
+			t.Errorf("%s messages = %+v, want %q %q", c.m.Conf.Language, msgs, c.title, c.content)
+		}
+	}
+}
+
+//各渠道的消息行由line.*模板生成，可按名称覆盖
+func TestTemplatesLine(t *testing.T) {
+	r := Result{Name: "Nginx", Type: "http", Target: "http://192.168.1.100:80", Status: StatusFailed, Info: AlertInfo{Runbook: "https://wiki/nginx"}}
+	msg := Message{Title: "HTTP -> Nginx", Content: "连接被拒绝", Event: Event{Kind: EventFailing, Result: r}, AckURL: "https://monitor/ack"}
+	want := "- **Nginx**（HTTP）｜ `http://192.168.1.100:80` ｜ 连接被拒绝 ｜ [处理手册](https://wiki/nginx) ｜ [确认](https://monitor/ack)"
+	if got := defaultTemplates.lineText("line.dingtalk", msg, true); got != want {
+		t.Errorf("line = %q, want %q", got, want)
+	}
+	if got, want := defaultTemplates.lineText("line.slack", msg, false), "连接被拒绝\n<https://monitor/ack|确认>"; got != want {
+		t.Errorf("slack line = %q, want %q", got, want)
+	}
+
+	dir, err := ioutil.TempDir("", "templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(filepath.Join(dir, "line.dingtalk.tmpl"), []byte("* {{.Instance}}: {{.Content}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tmpl := loadTemplatesForTest(t, "", dir)
+	if got, want := tmpl.lineText("line.dingtalk", msg, true), "* **Nginx**（HTTP）: 连接被拒绝"; got != want {
+		t.Errorf("overridden line = %q, want %q", got, want)
+	}
+}
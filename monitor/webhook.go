@@ -0,0 +1,238 @@
+// webhook
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//webhook发送方式
+const (
+	//每次运行的全部消息合并为一个请求（默认）
+	WebhookBatch = "batch"
+	//每条消息一个请求
+	WebhookEvent = "event"
+)
+
+//默认签名请求头
+const DefaultWebhookSignatureHeader = "X-Signature"
+
+//body模板中可用的函数
+var webhookFuncs = template.FuncMap{
+	//转为JSON值，用于在JSON模板中安全地嵌入字符串
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+func init() {
+	RegisterNotifier("webhook", func(nc NotifierConf) (Notifier, error) {
+		n := &WebhookNotifier{name: nc.Name, client: nc.client()}
+		if err := nc.Decode(n); err != nil {
+			return nil, err
+		}
+		if n.Url == "" {
+			return nil, fmt.Errorf("url is empty")
+		}
+		if n.Method == "" {
+			n.Method = http.MethodPost
+		}
+		n.Method = strings.ToUpper(n.Method)
+		switch n.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+		default:
+			return nil, fmt.Errorf("unsupported method %q", n.Method)
+		}
+		switch n.Mode {
+		case "":
+			n.Mode = WebhookBatch
+		case WebhookBatch, WebhookEvent:
+		default:
+			return nil, fmt.Errorf("unknown mode %q", n.Mode)
+		}
+		if n.Body != "" {
+			tmpl, err := template.New(nc.Name).Funcs(webhookFuncs).Option("missingkey=error").Parse(n.Body)
+			if err != nil {
+				return nil, fmt.Errorf("invalid body template: %v", err)
+			}
+			n.tmpl = tmpl
+		}
+		return n, nil
+	})
+}
+
+//通用webhook，请求体由body模板生成，不配置时为JSON
+type WebhookNotifier struct {
+	name string
+	//发送请求使用的客户端，超时由delivery.timeout配置
+	client  *http.Client
+	Url     string            `yaml:"url"`
+	Method  string            `yaml:"method"`
+	Headers map[string]string `yaml:"headers"`
+	//请求体的Content-Type，默认application/json
+	ContentType string `yaml:"content_type"`
+	//text/template格式的请求体模板，batch模式的数据为WebhookPayload，event模式为WebhookEventData
+	Body string `yaml:"body"`
+	//签名密钥，配置后在signature_header中附加sha256=hex(HmacSHA256(secret, 请求体))
+	Secret          string `yaml:"secret"`
+	SignatureHeader string `yaml:"signature_header"`
+	//发送方式：batch（默认）、event
+	Mode string `yaml:"mode"`
+	tmpl *template.Template
+}
+
+//一条消息的模板数据
+type WebhookEventData struct {
+	//事件类型：failing、repeat、recovered、flapping、stabilized、summary、escalated、acked、unreachable
+	Kind string `json:"kind"`
+	//级别：critical、warning、info、recovered
+	Severity string `json:"severity"`
+	Name     string `json:"name,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Target   string `json:"target,omitempty"`
+	//检查结果：ok、failed、timeout
+	Status string `json:"status,omitempty"`
+	//标题及告警内容
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	//检查结果信息
+	Error string `json:"error,omitempty"`
+	//检查耗时及故障持续时间，如“1.5s”
+	Duration string `json:"duration,omitempty"`
+	Downtime string `json:"downtime,omitempty"`
+	//连续失败次数
+	Failures int    `json:"failures,omitempty"`
+	Runbook  string `json:"runbook,omitempty"`
+	//故障确认链接，及确认人、备注
+	AckURL     string    `json:"ack_url,omitempty"`
+	AckBy      string    `json:"ack_by,omitempty"`
+	AckComment string    `json:"ack_comment,omitempty"`
+	Time       time.Time `json:"time"`
+	Hostname   string    `json:"hostname"`
+}
+
+//batch模式的模板数据
+type WebhookPayload struct {
+	Hostname string             `json:"hostname"`
+	Time     time.Time          `json:"time"`
+	Events   []WebhookEventData `json:"events"`
+}
+
+func (n *WebhookNotifier) Name() string { return n.name }
+
+//发送消息：batch模式一个请求，event模式每条消息一个请求
+func (n *WebhookNotifier) Notify(msgs []Message) error {
+	hostname, _ := os.Hostname()
+	now := time.Now()
+	if n.Mode == WebhookEvent {
+		var chunks []msgChunk
+		for _, msg := range msgs {
+			chunks = append(chunks, msgChunk{msgs: []Message{msg}})
+		}
+		return sendChunks(context.Background(), chunks, nil, func(c msgChunk) error {
+			return n.send(webhookEventData(c.msgs[0], hostname, now))
+		})
+	}
+	payload := WebhookPayload{Hostname: hostname, Time: now}
+	for _, msg := range msgs {
+		payload.Events = append(payload.Events, webhookEventData(msg, hostname, now))
+	}
+	return n.send(payload)
+}
+
+//生成请求体并发送
+func (n *WebhookNotifier) send(data interface{}) error {
+	body, err := n.render(data)
+	if err != nil {
+		return &DeliveryError{Err: err}
+	}
+	req, err := http.NewRequest(n.Method, n.Url, bytes.NewReader(body))
+	if err != nil {
+		return &DeliveryError{Err: err}
+	}
+	contentType := n.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range n.Headers {
+		req.Header.Set(k, v)
+	}
+	if n.Secret != "" {
+		header := n.SignatureHeader
+		if header == "" {
+			header = DefaultWebhookSignatureHeader
+		}
+		req.Header.Set(header, webhookSign(body, n.Secret))
+	}
+	_, err = httpDo(n.client, req)
+	return err
+}
+
+//按模板生成请求体，没有模板时为JSON
+func (n *WebhookNotifier) render(data interface{}) ([]byte, error) {
+	if n.tmpl == nil {
+		return json.Marshal(data)
+	}
+	var b bytes.Buffer
+	if err := n.tmpl.Execute(&b, data); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+//签名：sha256=hex(HmacSHA256(secret, body))
+func webhookSign(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+//消息对应的模板数据
+func webhookEventData(msg Message, hostname string, now time.Time) WebhookEventData {
+	e := msg.Event
+	r := e.Result
+	data := WebhookEventData{
+		Kind:     e.Kind.String(),
+		Severity: msg.Severity(),
+		Name:     r.Name,
+		Type:     r.Type,
+		Target:   r.Target,
+		Title:    msg.Title,
+		Content:  msg.Content,
+		Error:    r.Message,
+		Failures: e.Failures,
+		Runbook:  r.Info.Runbook,
+		Time:     r.Time,
+		Hostname: hostname,
+	}
+	if r.Name != "" {
+		data.Status = r.Status.String()
+	}
+	data.AckURL = msg.AckURL
+	if e.Ack != nil {
+		data.AckBy = e.Ack.By
+		data.AckComment = e.Ack.Comment
+	}
+	if r.Duration > 0 {
+		data.Duration = r.Duration.Round(time.Millisecond).String()
+	}
+	if e.Downtime > 0 {
+		data.Downtime = humanDuration(e.Downtime)
+	}
+	if data.Time.IsZero() {
+		data.Time = now
+	}
+	return data
+}
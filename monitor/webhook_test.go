@@ -0,0 +1,109 @@
+package monitor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+//本地模拟的webhook接口，记录收到的请求
+type fakeWebhook struct {
+	//返回的状态码，0为200
+	status   int
+	requests []*http.Request
+	bodies   []string
+}
+
+func (f *fakeWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	f.requests = append(f.requests, r)
+	f.bodies = append(f.bodies, string(body))
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+	}
+}
+
+func TestWebhookBatchJSON(t *testing.T) {
+	fake := &fakeWebhook{}
+	n, stop := newTestNotifier(t, "webhook", fake, "url", map[string]interface{}{"url": "/hook"})
+	defer stop()
+	if err := n.Notify(testEventMsgs()); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.requests) != 1 || fake.requests[0].Method != "POST" || fake.requests[0].Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("requests = %v", fake.requests)
+	}
+	var payload WebhookPayload
+	if err := json.Unmarshal([]byte(fake.bodies[0]), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload.Events) != 3 {
+		t.Fatalf("events = %+v", payload.Events)
+	}
+	e := payload.Events[2]
+	if e.Kind != "failing" || e.Severity != SeverityCritical || e.Name != "Nginx" || e.Status != "failed" || e.Error != "请求异常" || e.Runbook == "" {
+		t.Errorf("event = %+v", e)
+	}
+	if r := payload.Events[1]; r.Kind != "recovered" || r.Severity != "recovered" || r.Downtime != "12m" {
+		t.Errorf("recovered event = %+v", r)
+	}
+}
+
+func TestWebhookEventTemplate(t *testing.T) {
+	fake := &fakeWebhook{}
+	n, stop := newTestNotifier(t, "webhook", fake, "url", map[string]interface{}{
+		"url":     "/hook",
+		"method":  "put",
+		"mode":    "event",
+		"headers": map[string]string{"Authorization": "Bearer abc"},
+		"secret":  "s3cret",
+		"body":    `{"summary": {{json (printf "%s %s" .Name .Kind)}}, "detail": {{json .Content}}}`,
+	})
+	defer stop()
+	if err := n.Notify(testEventMsgs()); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.requests) != 3 {
+		t.Fatalf("got %d requests, want 3", len(fake.requests))
+	}
+	for i, r := range fake.requests {
+		if r.Method != "PUT" || r.Header.Get("Authorization") != "Bearer abc" {
+			t.Errorf("request %d: %s %v", i, r.Method, r.Header)
+		}
+		if got, want := r.Header.Get(DefaultWebhookSignatureHeader), webhookSign([]byte(fake.bodies[i]), "s3cret"); got != want {
+			t.Errorf("request %d signature = %s, want %s", i, got, want)
+		}
+		var body map[string]string
+		if err := json.Unmarshal([]byte(fake.bodies[i]), &body); err != nil {
+			t.Errorf("request %d body %q: %v", i, fake.bodies[i], err)
+		}
+	}
+	if !strings.Contains(fake.bodies[0], `"summary": "Redis failing"`) {
+		t.Errorf("body = %s", fake.bodies[0])
+	}
+}
+
+func TestWebhookErrors(t *testing.T) {
+	fake := &fakeWebhook{status: http.StatusBadRequest}
+	n, stop := newTestNotifier(t, "webhook", fake, "url", map[string]interface{}{"url": "/hook"})
+	defer stop()
+	if retry, _ := retryable(n.Notify(testMsgs)); retry {
+		t.Error("4xx response retried")
+	}
+	fake.status = http.StatusBadGateway
+	if retry, _ := retryable(n.Notify(testMsgs)); !retry {
+		t.Error("5xx response not retried")
+	}
+	for _, options := range []map[string]interface{}{
+		{"url": "http://example.com", "body": "{{.Name"},
+		{"url": "http://example.com", "mode": "stream"},
+		{"url": "http://example.com", "method": "DELETE"},
+		{},
+	} {
+		if _, err := NewNotifier(NotifierConf{Name: "w", Type: "webhook", Options: options}); err == nil {
+			t.Errorf("options %v accepted", options)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+// wecom
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+var wecomBaseServer = "https://qyapi.weixin.qq.com/cgi-bin/webhook/send"
+
+const (
+	//企业微信text消息内容最长2048字节，markdown最长4096字节，按消息体大小留出余量
+	wecomTextMaxBytes     = 2000
+	wecomMarkdownMaxBytes = 4000
+	//单次通知默认最多拆分的消息条数
+	DefaultWeComMaxMessages = 5
+	//每个机器人每分钟默认最多发送条数
+	DefaultWeComRateLimit = 20
+)
+
+//企业微信markdown中各级别的颜色，只支持info（绿）、comment（灰）、warning（橙红）
+var wecomColors = map[string]string{
+	SeverityCritical: "warning",
+	SeverityWarning:  "warning",
+	SeverityInfo:     "comment",
+	"recovered":      "info",
+}
+
+func init() {
+	RegisterNotifier("wecom", func(nc NotifierConf) (Notifier, error) {
+		n := &WeComNotifier{name: nc.Name, client: nc.client(), templates: nc.Templates}
+		if err := nc.Decode(n); err != nil {
+			return nil, err
+		}
+		if n.Key == "" {
+			return nil, fmt.Errorf("key is empty")
+		}
+		switch n.Msgtype {
+		case "", "text", "markdown":
+		default:
+			return nil, fmt.Errorf("unknown msgtype %q", n.Msgtype)
+		}
+		return n, nil
+	})
+}
+
+//企业微信群机器人
+type WeComNotifier struct {
+	name string
+	//发送请求使用的客户端，超时由delivery.timeout配置
+	client *http.Client
+	//消息文字使用的模板
+	templates *Templates
+	//机器人webhook地址中的key
+	Key string `yaml:"key"`
+	//机器人接口地址，默认为企业微信官方地址
+	Url string `yaml:"url"`
+	//消息类型：text（默认）、markdown
+	Msgtype string `yaml:"msgtype"`
+	//每次告警都提醒的成员userid及手机号，"@all"为所有人
+	MentionedList       []string `yaml:"mentioned_list"`
+	MentionedMobileList []string `yaml:"mentioned_mobile_list"`
+	//单次通知最多拆分条数及每分钟最多发送条数
+	MaxMessages int `yaml:"max_messages"`
+	RateLimit   int `yaml:"rate_limit"`
+}
+
+func (n *WeComNotifier) Name() string { return n.name }
+
+//发送消息，限流等待不可取消，见NotifyContext
+func (n *WeComNotifier) Notify(msgs []Message) error {
+	return n.NotifyContext(context.Background(), msgs)
+}
+
+//发送消息到企业微信：按级别排序后拆分为不超过大小限制的多条消息，按机器人限流依次发送；
+//markdown消息不支持按手机号提醒，需要提醒时另发一条text消息
+func (n *WeComNotifier) NotifyContext(ctx context.Context, msgs []Message) error {
+	limiter := limiterOf("wecom/"+n.Key, positive(n.RateLimit, DefaultWeComRateLimit), time.Minute)
+	maxBytes := wecomTextMaxBytes
+	if n.Msgtype == "markdown" {
+		maxBytes = wecomMarkdownMaxBytes
+	}
+	chunks := splitChunks(n.templates, sortBySeverity(msgs), maxBytes, positive(n.MaxMessages, DefaultWeComMaxMessages), n.size)
+	err := sendChunks(ctx, chunks, limiter, func(c msgChunk) error {
+		return n.send(n.chunkPayload(c))
+	})
+	if err != nil || n.Msgtype != "markdown" {
+		return err
+	}
+	if mobiles := n.mobiles(msgs); len(mobiles) > 0 {
+		if err := limiter.wait(ctx); err != nil {
+			log.Errorf("Send wecom mentions error: %v", err)
+			return nil
+		}
+		payload := map[string]interface{}{
+			"msgtype": "text",
+			"text":    map[string]interface{}{"content": n.templates.render("batch.mention", nil), "mentioned_mobile_list": mobiles},
+		}
+		//告警本身已送达，提醒失败时不再重发
+		if err := n.send(payload); err != nil {
+			log.Errorf("Send wecom mentions error: %v", err)
+		}
+	}
+	return nil
+}
+
+//发送一条消息
+func (n *WeComNotifier) send(payload map[string]interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	body, err := httpPost(n.client, n.webhook(), "application/json", string(data))
+	if err != nil {
+		return err
+	}
+	return wecomError(body)
+}
+
+//解析企业微信返回的errcode，0为成功
+func wecomError(body []byte) error {
+	var resp struct {
+		Errcode int    `json:"errcode"`
+		Errmsg  string `json:"errmsg"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return &DeliveryError{Err: fmt.Errorf("invalid wecom response %q: %v", body, err), Temporary: true}
+	}
+	switch resp.Errcode {
+	case 0:
+		return nil
+	case 45009:
+		//接口调用超过限制，每个机器人每分钟最多20条
+		return &DeliveryError{Err: fmt.Errorf("wecom rate limited: %s", resp.Errmsg), RateLimited: true}
+	case -1:
+		//系统繁忙
+		return &DeliveryError{Err: fmt.Errorf("wecom busy: %s", resp.Errmsg), Temporary: true}
+	default:
+		return &DeliveryError{Err: fmt.Errorf("wecom error %d: %s", resp.Errcode, resp.Errmsg)}
+	}
+}
+
+//消息体的字节数
+func (n *WeComNotifier) size(c msgChunk) int {
+	data, _ := json.Marshal(n.chunkPayload(c))
+	return len(data)
+}
+
+//按msgtype生成消息体
+func (n *WeComNotifier) chunkPayload(c msgChunk) map[string]interface{} {
+	if n.Msgtype == "markdown" {
+		return map[string]interface{}{
+			"msgtype":  "markdown",
+			"markdown": map[string]string{"content": n.markdown(c)},
+		}
+	}
+	var content = n.templates.batchTitle(c) + "\n"
+	for _, msg := range c.msgs {
+		content += msg.Title + "\n" + msg.Content + "\n"
+	}
+	if len(c.overflow) > 0 {
+		content += n.templates.overflowText(c.overflow) + "\n"
+	}
+	text := map[string]interface{}{"content": strings.TrimRight(content, "\n")}
+	if len(n.MentionedList) > 0 {
+		text["mentioned_list"] = n.MentionedList
+	}
+	//未展示的故障同样需要提醒相关的人
+	if mobiles := n.mobiles(append(c.msgs[:len(c.msgs):len(c.msgs)], c.overflow...)); len(mobiles) > 0 {
+		text["mentioned_mobile_list"] = mobiles
+	}
+	return map[string]interface{}{"msgtype": "text", "text": text}
+}
+
+//markdown正文：标题汇总各级别数量，每个级别一个小标题，下面逐行列出实例、目标及错误，见line.wecom模板
+func (n *WeComNotifier) markdown(c msgChunk) string {
+	var b strings.Builder
+	groups := GroupBySeverity(c.msgs)
+	b.WriteString("**" + n.templates.batchTitle(c) + "**\n")
+	for _, g := range groups {
+		fmt.Fprintf(&b, "### <font color=\"%s\">%s</font>\n", wecomColors[g.Severity], n.templates.groupTitle(g))
+		for _, msg := range g.Msgs {
+			b.WriteString(n.templates.lineText("line.wecom", msg, true) + "\n")
+		}
+	}
+	if len(c.overflow) > 0 {
+		b.WriteString(n.templates.overflowText(c.overflow) + "\n")
+	}
+	//markdown消息通过<@userid>提醒成员
+	for _, user := range n.MentionedList {
+		b.WriteString("<@" + user + ">")
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+//需要提醒的手机号：有故障消息时为渠道配置的mentioned_mobile_list及实例配置的at_mobiles/at_all，只有恢复消息时不提醒
+func (n *WeComNotifier) mobiles(msgs []Message) []string {
+	var mobiles []string
+	seen := map[string]bool{}
+	add := func(mobile string) {
+		if !seen[mobile] {
+			seen[mobile] = true
+			mobiles = append(mobiles, mobile)
+		}
+	}
+	for _, msg := range msgs {
+		if msg.Severity() == "recovered" {
+			continue
+		}
+		for _, mobile := range n.MentionedMobileList {
+			add(mobile)
+		}
+		for _, mobile := range msg.Event.Result.Info.AtMobiles {
+			add(mobile)
+		}
+		if msg.Event.Result.Info.AtAll {
+			add("@all")
+		}
+	}
+	return mobiles
+}
+
+//机器人地址
+func (n *WeComNotifier) webhook() string {
+	base := n.Url
+	if base == "" {
+		base = wecomBaseServer
+	}
+	return base + "?" + url.Values{"key": {n.Key}}.Encode()
+}
@@ -0,0 +1,98 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//本地模拟的企业微信机器人接口
+type fakeWeCom struct {
+	key string
+	//收到的消息体
+	payloads []map[string]interface{}
+}
+
+func (f *fakeWeCom) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reply := func(code int, msg string) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"errcode": code, "errmsg": msg})
+	}
+	if r.URL.Query().Get("key") != f.key {
+		reply(93000, "invalid webhook url")
+		return
+	}
+	var payload map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		reply(40008, "invalid message type")
+		return
+	}
+	f.payloads = append(f.payloads, payload)
+	reply(0, "ok")
+}
+
+func TestWeComText(t *testing.T) {
+	fake := &fakeWeCom{key: "k1"}
+	n, stop := newTestNotifier(t, "wecom", fake, "url", map[string]interface{}{"key": "k1", "mentioned_mobile_list": []string{"13800000009"}})
+	defer stop()
+	if err := n.Notify(testEventMsgs()); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.payloads) != 1 || fake.payloads[0]["msgtype"] != "text" {
+		t.Fatalf("payloads = %v", fake.payloads)
+	}
+	text := fake.payloads[0]["text"].(map[string]interface{})
+	content := text["content"].(string)
+	//严重的故障排在前面
+	if strings.Index(content, "Nginx") > strings.Index(content, "Redis") || !strings.Contains(content, "MySQL") {
+		t.Errorf("content = %q", content)
+	}
+	//恢复实例的at_mobiles不提醒
+	want := []interface{}{"13800000009", "13800000001"}
+	if got := text["mentioned_mobile_list"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("mentioned_mobile_list = %v, want %v", got, want)
+	}
+}
+
+func TestWeComMarkdown(t *testing.T) {
+	fake := &fakeWeCom{key: "k2"}
+	n, stop := newTestNotifier(t, "wecom", fake, "url", map[string]interface{}{"key": "k2", "msgtype": "markdown", "mentioned_list": []string{"zhangsan"}})
+	defer stop()
+	if err := n.Notify(testEventMsgs()); err != nil {
+		t.Fatal(err)
+	}
+	//markdown之后另发一条text按手机号提醒
+	if len(fake.payloads) != 2 || fake.payloads[0]["msgtype"] != "markdown" || fake.payloads[1]["msgtype"] != "text" {
+		t.Fatalf("payloads = %v", fake.payloads)
+	}
+	content := fake.payloads[0]["markdown"].(map[string]interface{})["content"].(string)
+	for _, want := range []string{`<font color="warning">严重（1）</font>`, `<font color="info">已恢复（1）</font>`, "[处理手册](https://wiki.example.com/nginx)", "<@zhangsan>"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("markdown missing %q:\n%s", want, content)
+		}
+	}
+	mobiles := fake.payloads[1]["text"].(map[string]interface{})["mentioned_mobile_list"]
+	if !reflect.DeepEqual(mobiles, []interface{}{"13800000001"}) {
+		t.Errorf("mentioned_mobile_list = %v", mobiles)
+	}
+}
+
+func TestWeComInvalidKey(t *testing.T) {
+	fake := &fakeWeCom{key: "k3"}
+	n, stop := newTestNotifier(t, "wecom", fake, "url", map[string]interface{}{"key": "wrong"})
+	defer stop()
+	err := n.Notify(testMsgs)
+	if retry, _ := retryable(err); err == nil || retry {
+		t.Errorf("err = %v, want permanent error", err)
+	}
+}
+
+func TestWeComConf(t *testing.T) {
+	if _, err := NewNotifier(NotifierConf{Name: "w", Type: "wecom"}); err == nil {
+		t.Error("missing key accepted")
+	}
+	if _, err := NewNotifier(NotifierConf{Name: "w", Type: "wecom", Options: map[string]interface{}{"key": "k", "msgtype": "news"}}); err == nil {
+		t.Error("unknown msgtype accepted")
+	}
+}
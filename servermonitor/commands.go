@@ -0,0 +1,387 @@
+// commands
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/github188/ServerMonitor/monitor"
+)
+
+//run：检查全部实例
+func runCmd(args []string) int {
+	return runChecks("run", args, nil)
+}
+
+//check：只检查指定类型的实例
+func checkCmd(args []string) int {
+	return runChecks("check", args, monitor.Types())
+}
+
+//执行检查，allowed不为空时要求至少指定一个其中的类型
+func runChecks(name string, args []string, allowed []string) int {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	daemon := fs.Bool("daemon", false, "守护进程模式，按实例interval循环检查直到收到退出信号")
+	types, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if allowed != nil {
+		if len(types) == 0 {
+			fmt.Fprintf(os.Stderr, "check: missing type, one of %v\n", allowed)
+			return 2
+		}
+		for _, typ := range types {
+			if !contains(allowed, typ) {
+				fmt.Fprintf(os.Stderr, "check: unknown type %q, one of %v\n", typ, allowed)
+				return 2
+			}
+		}
+	} else if len(types) > 0 {
+		fmt.Fprintf(os.Stderr, "%s: unexpected arguments %v\n", name, types)
+		return 2
+	}
+
+	conf, ok := loadConf()
+	if !ok {
+		return 1
+	}
+	if !conf.Enabled {
+		log.Info("Monitor disabled")
+		return 0
+	}
+	m := monitor.New(conf, types...)
+	if *daemon {
+		//收到SIGTERM/SIGINT后等待进行中的检查结束再退出
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+		defer stop()
+		m.RunDaemon(ctx)
+		return 0
+	}
+	m.RunOnce(context.Background())
+	return 0
+}
+
+//validate-config：校验配置文件
+func validateCmd(args []string) int {
+	conf, ok := loadConf()
+	if !ok {
+		return 1
+	}
+	errs := conf.Validate()
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *configFile, err)
+	}
+	if len(errs) > 0 {
+		return 1
+	}
+	fmt.Printf("%s: ok, %d instances\n", *configFile, len(monitor.NewCheckers(conf)))
+	return 0
+}
+
+//test-notify：向全部（或指定名称的）通知渠道发送一条测试消息
+func testNotifyCmd(args []string) int {
+	conf, ok := loadConf()
+	if !ok {
+		return 1
+	}
+	templates, err := monitor.LoadTemplates(conf.Language, conf.Templates)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "test-notify: %v\n", err)
+		return 1
+	}
+	//指定名称时只创建这些渠道，未启用的也发送
+	if len(args) > 0 {
+		for i := range conf.Notifiers {
+			enabled := contains(args, conf.Notifiers[i].Name)
+			conf.Notifiers[i].Enabled = &enabled
+		}
+	}
+	code := 0
+	notifiers, err := monitor.NewNotifiers(conf, templates)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "test-notify: %v\n", err)
+		code = 1
+	}
+	hostname, _ := os.Hostname()
+	msg := templates.TestMessage(hostname)
+	sent := 0
+	for _, n := range notifiers {
+		if len(args) > 0 && !contains(args, n.Name()) {
+			continue
+		}
+		sent++
+		if err := n.Notify([]monitor.Message{msg}); err != nil {
+			fmt.Fprintf(os.Stderr, "test-notify %s: %v\n", n.Name(), err)
+			code = 1
+			continue
+		}
+		fmt.Printf("test-notify %s: sent\n", n.Name())
+	}
+	if sent == 0 && code == 0 {
+		fmt.Fprintln(os.Stderr, "test-notify: no notifier matched")
+		return 1
+	}
+	return code
+}
+
+//list：列出配置的实例
+func listCmd(args []string) int {
+	conf, ok := loadConf()
+	if !ok {
+		return 1
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tNAME\tTARGET\tINTERVAL")
+	for _, c := range monitor.NewCheckers(conf) {
+		interval := conf.IntervalOf(0)
+		if i, ok := c.(monitor.Intervaler); ok && i.Interval() > 0 {
+			interval = i.Interval()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%v\n", c.Type(), c.Name(), monitor.TargetOf(c), interval)
+	}
+	w.Flush()
+	return 0
+}
+
+//ack：确认实例当前的故障，配置了ack.listen时通过守护进程的确认接口，否则直接修改状态存储
+func ackCmd(args []string) int {
+	fs := flag.NewFlagSet("ack", flag.ContinueOnError)
+	comment := fs.String("m", "", "确认备注，随后续通知及恢复消息发送")
+	by := fs.String("by", os.Getenv("USER"), "确认人")
+	instances, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(instances) != 1 {
+		fmt.Fprintln(os.Stderr, "ack: need exactly one instance, name or type/name")
+		return 2
+	}
+	conf, ok := loadConf()
+	if !ok {
+		return 1
+	}
+	ack := monitor.Ack{Time: time.Now(), By: *by, Comment: *comment}
+	if conf.Ack.Listen != "" {
+		err = monitor.RemoteAck(conf.Ack, instances[0], ack)
+	} else {
+		var m *monitor.Monitor
+		if m, err = localMonitor(conf); err == nil {
+			err = m.Ack(instances[0], ack)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ack %s: %v\n", instances[0], err)
+		return 1
+	}
+	fmt.Printf("ack %s: acknowledged\n", instances[0])
+	return 0
+}
+
+//silence：管理静默，配置了ack.listen时通过守护进程的静默接口，否则直接修改状态存储
+func silenceCmd(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "silence: missing action, one of add, list, expire")
+		return 2
+	}
+	switch args[0] {
+	case "add":
+		return silenceAddCmd(args[1:])
+	case "list":
+		return silenceListCmd(args[1:])
+	case "expire":
+		return silenceExpireCmd(args[1:])
+	}
+	fmt.Fprintf(os.Stderr, "silence: unknown action %q, one of add, list, expire\n", args[0])
+	return 2
+}
+
+//silence add：创建临时静默
+func silenceAddCmd(args []string) int {
+	fs := flag.NewFlagSet("silence add", flag.ContinueOnError)
+	var names, types, tags listFlag
+	fs.Var(&names, "name", "匹配的实例名称或 类型/名称，可重复")
+	fs.Var(&types, "type", "匹配的检查类型，可重复")
+	fs.Var(&tags, "tag", "匹配的实例标签 key=value，可重复")
+	duration := fs.Duration("for", 0, "持续时长，如2h")
+	until := fs.String("until", "", "结束时间，如\"2024-05-01 04:00\"")
+	comment := fs.String("m", "", "静默说明")
+	by := fs.String("by", os.Getenv("USER"), "创建人")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(rest) > 0 {
+		fmt.Fprintf(os.Stderr, "silence add: unexpected arguments %v\n", rest)
+		return 2
+	}
+	s := monitor.Silence{Names: names, Types: types, Comment: *comment, CreatedBy: *by, Start: time.Now()}
+	for _, tag := range tags {
+		kv := strings.SplitN(tag, "=", 2)
+		if len(kv) != 2 {
+			fmt.Fprintf(os.Stderr, "silence add: invalid tag %q, want key=value\n", tag)
+			return 2
+		}
+		if s.Match == nil {
+			s.Match = map[string]string{}
+		}
+		s.Match[kv[0]] = kv[1]
+	}
+	switch {
+	case *duration > 0 && *until == "":
+		s.End = s.Start.Add(*duration)
+	case *duration == 0 && *until != "":
+		if s.End, err = time.ParseInLocation("2006-01-02 15:04", *until, time.Local); err != nil {
+			fmt.Fprintf(os.Stderr, "silence add: invalid until %q, want \"YYYY-MM-DD HH:MM\"\n", *until)
+			return 2
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "silence add: need one of --for or --until")
+		return 2
+	}
+	conf, ok := loadConf()
+	if !ok {
+		return 1
+	}
+	if conf.Ack.Listen != "" {
+		s, err = monitor.RemoteAddSilence(conf.Ack, s)
+	} else {
+		var m *monitor.Monitor
+		if m, err = localMonitor(conf); err == nil {
+			s, err = m.AddSilence(s)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "silence add: %v\n", err)
+		return 1
+	}
+	fmt.Printf("silence %s: added until %s\n", s.ID, s.End.Format("2006-01-02 15:04:05"))
+	return 0
+}
+
+//silence list：列出配置的及临时创建的静默
+func silenceListCmd(args []string) int {
+	conf, ok := loadConf()
+	if !ok {
+		return 1
+	}
+	var (
+		silences []monitor.Silence
+		err      error
+	)
+	if conf.Ack.Listen != "" {
+		silences, err = monitor.RemoteSilences(conf.Ack)
+	} else {
+		silences = monitor.New(conf).Silences()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "silence list: %v\n", err)
+		return 1
+	}
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tACTIVE\tMATCH\tWINDOW\tCREATED BY\tCOMMENT")
+	for _, s := range silences {
+		var match []string
+		match = append(match, s.Names...)
+		for _, typ := range s.Types {
+			match = append(match, "type="+typ)
+		}
+		var tags []string
+		for k, v := range s.Match {
+			tags = append(tags, k+"="+v)
+		}
+		sort.Strings(tags)
+		match = append(match, tags...)
+		if len(match) == 0 {
+			match = append(match, "*")
+		}
+		window := s.Start.Format("2006-01-02 15:04") + " ~ " + s.End.Format("2006-01-02 15:04")
+		if s.Cron != "" {
+			window = fmt.Sprintf("%s for %v", s.Cron, s.Duration)
+		} else if s.Start.IsZero() {
+			window = "~ " + s.End.Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%s\t%v\t%s\t%s\t%s\t%s\n", s.ID, s.Active(now), strings.Join(match, ","), window, s.CreatedBy, s.Comment)
+	}
+	w.Flush()
+	return 0
+}
+
+//silence expire：提前结束临时静默
+func silenceExpireCmd(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "silence expire: need exactly one silence id")
+		return 2
+	}
+	conf, ok := loadConf()
+	if !ok {
+		return 1
+	}
+	var err error
+	if conf.Ack.Listen != "" {
+		err = monitor.RemoteExpireSilence(conf.Ack, args[0])
+	} else {
+		var m *monitor.Monitor
+		if m, err = localMonitor(conf); err == nil {
+			err = m.ExpireSilence(args[0])
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "silence expire: %v\n", err)
+		return 1
+	}
+	fmt.Printf("silence %s: expired\n", args[0])
+	return 0
+}
+
+//直接修改状态存储的监控；使用同一状态的守护进程运行中时其内存中的状态会覆盖修改，此时返回错误
+func localMonitor(conf *monitor.Conf) (*monitor.Monitor, error) {
+	if pid := monitor.DaemonPid(conf); pid != 0 {
+		return nil, fmt.Errorf("daemon (pid %d) is running on the same state and would overwrite the change, configure ack.listen to go through the daemon", pid)
+	}
+	return monitor.New(conf), nil
+}
+
+//可重复的字符串标志
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+//解析参数，允许标志与位置参数交错，如 check http --daemon
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
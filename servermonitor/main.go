@@ -0,0 +1,78 @@
+// servermonitor
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	log "github.com/cihub/seelog"
+	"github.com/github188/ServerMonitor/monitor"
+)
+
+var configFile = flag.String("c", "config.yml", "配置文件路径")
+
+//子命令
+type command struct {
+	name  string
+	args  string
+	usage string
+	run   func(args []string) int
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"run", "[--daemon]", "检查全部实例", runCmd},
+		{"check", "http|tcp|mysql|redis|ping [--daemon]", "只检查指定类型的实例", checkCmd},
+		{"validate-config", "", "校验配置文件", validateCmd},
+		{"test-notify", "[name...]", "向通知渠道发送一条测试消息", testNotifyCmd},
+		{"list", "", "列出配置的实例", listCmd},
+		{"ack", "<instance> [-m comment] [--by name]", "确认实例当前的故障，停止重复通知及升级", ackCmd},
+		{"silence", "add|list|expire [arguments]", "管理静默（维护窗口）", silenceCmd},
+	}
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	monitor.InitLogFileWriter()
+	code := dispatch(flag.Args())
+	log.Flush()
+	os.Exit(code)
+}
+
+//执行子命令，未指定时等同run
+func dispatch(args []string) int {
+	if len(args) == 0 {
+		return runCmd(nil)
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:])
+		}
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+	usage()
+	return 2
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: servermonitor [-c config.yml] <command> [arguments]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-16s %-36s %s\n", cmd.name, cmd.args, cmd.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+//读取配置文件
+func loadConf() (*monitor.Conf, bool) {
+	conf, err := monitor.LoadConf(*configFile)
+	if err != nil {
+		log.Errorf("Load config error: %v", err)
+		return nil, false
+	}
+	return conf, true
+}